@@ -13,7 +13,7 @@ require (
 	github.com/jackc/pgx/v4 v4.15.0
 	github.com/matoous/go-nanoid/v2 v2.0.0
 	github.com/sanity-io/litter v1.5.2
-	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e // indirect
-	golang.org/x/image v0.0.0-20211028202545-6944b10bf410 // indirect
+	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 	golang.org/x/sys v0.0.0-20211204120058-94396e421777 // indirect
 )
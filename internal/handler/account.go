@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+//delete account handler
+func (h *handler) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.DeleteAccount(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//export account handler, the archive is built in memory so errors can still be reported
+func (h *handler) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	err := h.ExportAccount(r.Context(), &b)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="socially-export-`+time.Now().Format("2006-01-02")+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type createAPIKeyInput struct {
+	Label       string   `json:"label" validate:"required,min=1,max=50"`
+	ReadOnly    bool     `json:"read_only"`
+	RouteGroups []string `json:"route_groups" validate:"omitempty,dive,required"`
+}
+
+type labelAPIKeyInput struct {
+	Label string `json:"label" validate:"required,min=1,max=50"`
+}
+
+//create api key handler
+func (h *handler) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var in createAPIKeyInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.Label = strings.TrimSpace(in.Label)
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.CreateAPIKey(r.Context(), in.Label, in.ReadOnly, in.RouteGroups)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrInvalidRouteGroup {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusCreated)
+}
+
+//get api keys handler
+func (h *handler) getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.APIKeys(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//label api key handler
+func (h *handler) labelAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var in labelAPIKeyInput
+	err = json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.Label = strings.TrimSpace(in.Label)
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.LabelAPIKey(r.Context(), keyID, in.Label)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//revoke api key handler
+func (h *handler) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.RevokeAPIKey(r.Context(), keyID)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,14 +3,22 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/paritoshyadav/socialnetwork/internal/service"
+	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
 )
 
 type loginInput struct {
-	Email string `validate:"required,email"`
+	Email    string  `validate:"required,email"`
+	Password *string `json:"password" validate:"omitempty,max=128"`
+}
+
+type verifyLoginInput struct {
+	Code string `json:"code" validate:"required"`
 }
 
 func (h *handler) login(w http.ResponseWriter, r *http.Request) {
@@ -26,7 +34,49 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
 		return
 	}
-	lo, err := h.Login(r.Context(), in.Email)
+	if in.Password != nil {
+		lo, err := h.PasswordLogin(r.Context(), in.Email, *in.Password)
+		if err == service.ErrInvalidCredentials {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+		response(w, lo, http.StatusOK)
+		return
+	}
+	err = h.Login(r.Context(), in.Email)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+}
+
+// verifyLogin accepts the code from the magic link query or from a json body
+func (h *handler) verifyLogin(w http.ResponseWriter, r *http.Request) {
+	in := verifyLoginInput{Code: r.URL.Query().Get("code")}
+	if in.Code == "" && r.Method == http.MethodPost {
+		err := json.NewDecoder(r.Body).Decode(&in)
+		defer r.Body.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	err := ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	lo, err := h.VerifyLogin(r.Context(), in.Code)
+	if err == service.ErrInvalidLoginCode {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	if err == service.ErrUserNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -66,6 +116,15 @@ func (h *handler) withAuth(next http.Handler) http.Handler {
 
 		token := r.Header.Get("Authorization")
 
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			h.withAPIKey(w, r, key, next)
+			return
+		}
+		if strings.HasPrefix(token, "Bearer "+service.APIKeyPrefix) {
+			h.withAPIKey(w, r, token[7:], next)
+			return
+		}
+
 		if !strings.HasPrefix(token, "Bearer") {
 			next.ServeHTTP(w, r)
 			return
@@ -74,14 +133,115 @@ func (h *handler) withAuth(next http.Handler) http.Handler {
 
 		token = token[7:] //remove prefix Bearer from token
 
-		uid, err := h.Codec.DecodeAuthID(token)
+		claims, err := h.Codec.DecodeClaims(token)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		active, err := h.SessionActive(r.Context(), claims.UserID, claims.SessionID)
+		if err != nil {
+			responseError(w, err)
+			return
+		}
+		if !active {
+			http.Error(w, service.ErrUnAuthorized.Error(), http.StatusUnauthorized)
+			return
 		}
 
-		ctx := context.WithValue(r.Context(), service.KeyAuthUserID, uid)
+		if !claims.HasScope(requiredScope(r)) {
+			http.Error(w, service.ErrMissingScope.Error(), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), service.KeyAuthClaims, claims)
+		ctx = context.WithValue(ctx, service.KeyAuthUserID, claims.UserID)
+		ctx = context.WithValue(ctx, service.KeyAuthSessionID, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 
 }
+
+// withAPIKey authenticates bots and scripts using a personal api key instead of a session token.
+func (h *handler) withAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	claims, apiKey, err := h.AuthenticateAPIKey(r.Context(), key)
+	if err == service.ErrInvalidAPIKey {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	if !apiKey.Allows(routeGroup(r)) || apiKeyDenied(r) {
+		http.Error(w, service.ErrRouteGroupNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+	if !claims.HasScope(requiredScope(r)) {
+		http.Error(w, service.ErrMissingScope.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), service.KeyAuthClaims, claims)
+	ctx = context.WithValue(ctx, service.KeyAuthUserID, claims.UserID)
+	ctx = context.WithValue(ctx, service.KeyAuthAPIKey, apiKey)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// apiKeyDeniedRoutes guard the credentials and data of the account, only a session of the owner can use them.
+var apiKeyDeniedRoutes = []string{
+	"/api/users/password",
+	"/api/users/me/username",
+	"/api/users/me/2fa",
+	"/api/users/me/identities",
+	"/api/users/me/export",
+}
+
+// apiKeyDenied reports if the request targets an account route, so bots can not lock out or impersonate their owner.
+func apiKeyDenied(r *http.Request) bool {
+	p := path.Clean(r.URL.Path)
+	if p == "/api/users/me" && r.Method == http.MethodDelete {
+		return true
+	}
+	for _, route := range apiKeyDeniedRoutes {
+		if p == route || strings.HasPrefix(p, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// routeGroup is the first path segment after /api, "/api/posts/1" belongs to "posts".
+func routeGroup(r *http.Request) string {
+	p := strings.TrimPrefix(r.URL.Path, "/api/")
+	if i := strings.Index(p, "/"); i >= 0 {
+		p = p[:i]
+	}
+	return p
+}
+
+// requiredScope maps safe methods to the read scope and everything else to write.
+func requiredScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return codec.ScopeRead
+	}
+	return codec.ScopeWrite
+}
+
+// withClientInfo stores the user agent and ip of the request so new sessions can record the device.
+func (h *handler) withClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		ctx := context.WithValue(r.Context(), service.KeyClientInfo, service.ClientInfo{
+			UserAgent: r.UserAgent(),
+			IP:        ip,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+//block user handler
+func (h *handler) blockHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.Block(r.Context(), username)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrInvalidBlock {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//unblock user handler
+func (h *handler) unblockHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.Unblock(r.Context(), username)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
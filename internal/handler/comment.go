@@ -40,6 +40,10 @@ func (h *handler) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if err == service.ErrEmailNotVerified {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err == service.ErrUserNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -48,6 +52,10 @@ func (h *handler) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		responseError(w, err)
 		return
@@ -81,6 +89,10 @@ func (h *handler) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		responseError(w, err)
 		return
@@ -106,6 +118,10 @@ func (h *handler) toggleCommentLikeHandler(w http.ResponseWriter, r *http.Reques
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		responseError(w, err)
 		return
@@ -113,3 +129,31 @@ func (h *handler) toggleCommentLikeHandler(w http.ResponseWriter, r *http.Reques
 	response(w, out, http.StatusOK)
 
 }
+
+//delete comment handler
+func (h *handler) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.DeleteComment(ctx, commentID)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrCommentNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrNotCommentAuthor {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
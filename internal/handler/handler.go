@@ -15,25 +15,64 @@ func New(s *service.Service) http.Handler {
 	h := &handler{s}
 
 	api := chi.NewRouter()
+	api.Use(h.withClientInfo)
 
 	api.Post("/login", h.login)
+	api.Get("/login/verify", h.verifyLogin)
+	api.Post("/login/verify", h.verifyLogin)
+	api.Post("/login/mfa", h.verifyMFAHandler)
+	api.Post("/refresh", h.refreshHandler)
+	api.Get("/oauth/{provider}", h.oidcLoginHandler)
+	api.Get("/oauth/{provider}/callback", h.oidcCallbackHandler)
+	api.Get("/verify_email", h.verifyEmailHandler)
+	api.Get("/password_reset", h.passwordResetPage)
 	api.Post("/users", h.createUser)
+	api.Get("/img/*", h.staticHandler)
+	api.Head("/img/*", h.staticHandler)
 
 	api.Route("/api", func(r chi.Router) {
 		r.Use(h.withAuth)
 		r.Post("/login", h.login)
+		r.Post("/login/verify", h.verifyLogin)
 		r.Get("/auth", h.checkUserAuth)
 		r.Route("/posts", func(r chi.Router) {
 			r.Post("/", h.createPost)
 			r.Post("/{postID}/toggle_likes", h.toggleLikePostHandler)
 			r.Get("/{postID}", h.getPostHandler)
+			r.Patch("/{postID}", h.updatePostHandler)
+			r.Delete("/{postID}", h.deletePostHandler)
+			r.Get("/{postID}/revisions", h.getPostRevisionsHandler)
 			r.Post("/{postID}/comments", h.createCommentHandler)
 			r.Post("/{postID}/toggle_subscription", h.togglePostSubscriptionHandler)
 			r.Get("/{postID}/comments", h.getCommentsHandler)
 
 		})
+		r.Route("/api_keys", func(r chi.Router) {
+			r.Get("/", h.getAPIKeysHandler)
+			r.Post("/", h.createAPIKeyHandler)
+			r.Patch("/{keyID}", h.labelAPIKeyHandler)
+			r.Delete("/{keyID}", h.revokeAPIKeyHandler)
+		})
+		r.Route("/sessions", func(r chi.Router) {
+			r.Get("/", h.getSessionsHandler)
+			r.Delete("/", h.revokeSessionsHandler)
+			r.Delete("/{sessionID}", h.revokeSessionHandler)
+		})
 		r.Get("/timeline", h.getTimeline)
+		r.Route("/lists", func(r chi.Router) {
+			r.Post("/", h.createListHandler)
+			r.Get("/subscribed", h.getSubscribedListsHandler)
+			r.Get("/{listID}", h.getListHandler)
+			r.Delete("/{listID}", h.deleteListHandler)
+			r.Get("/{listID}/members", h.getListMembersHandler)
+			r.Post("/{listID}/members", h.addListMemberHandler)
+			r.Delete("/{listID}/members/{username}", h.removeListMemberHandler)
+			r.Post("/{listID}/toggle_subscription", h.toggleListSubscriptionHandler)
+			r.Get("/{listID}/timeline", h.getListTimelineHandler)
+		})
+		r.Get("/relationships", h.relationshipsHandler)
 		r.Post("/comments/{commentID}/toggle_likes", h.toggleCommentLikeHandler)
+		r.Delete("/comments/{commentID}", h.deleteCommentHandler)
 		r.Route("/notifications", func(r chi.Router) {
 			r.Get("/", h.getNotificationsHandler)
 			r.Post("/mark_as_read", h.markAllNotificationsAsReadHandler)
@@ -43,12 +82,45 @@ func New(s *service.Service) http.Handler {
 		r.Route("/users", func(r chi.Router) {
 			r.Post("/", h.createUser)
 			r.Get("/", h.searchUser)
-			r.Post("/{username}/follow", h.toggleFollow)
-			r.Get("/{username}", h.userProfile)
-			r.Get("/{username}/followers", h.followers)
-			r.Get("/{username}/followings", h.followings)
-			r.Get("/{username}/posts", h.getUserPostsHandler)
+			r.Get("/suggestions", h.suggestionsHandler)
+			r.Route("/{username}", func(r chi.Router) {
+				r.Use(h.withRenamedRedirect)
+				r.Get("/", h.userProfile)
+				r.Post("/follow", h.toggleFollow)
+				r.Post("/block", h.blockHandler)
+				r.Delete("/block", h.unblockHandler)
+				r.Post("/mute", h.muteHandler)
+				r.Delete("/mute", h.unmuteHandler)
+				r.Get("/followers", h.followers)
+				r.Get("/followings", h.followings)
+				r.Get("/mutuals", h.mutualsHandler)
+				r.Get("/lists", h.getUserListsHandler)
+				r.Get("/posts", h.getUserPostsHandler)
+			})
 			r.Put("/avatar", h.updateAvatar)
+			r.Put("/banner", h.updateBanner)
+			r.Put("/password", h.changePasswordHandler)
+			r.Patch("/me", h.updateProfileHandler)
+			r.Put("/me/username", h.changeUsernameHandler)
+			r.Put("/me/privacy", h.setPrivacyHandler)
+			r.Get("/me/follow_requests", h.getFollowRequestsHandler)
+			r.Post("/me/follow_requests/{username}/approve", h.approveFollowRequestHandler)
+			r.Delete("/me/follow_requests/{username}", h.rejectFollowRequestHandler)
+			r.Get("/me/mutes", h.getMutesHandler)
+			r.Get("/me/muted_words", h.getMutedWordsHandler)
+			r.Post("/me/muted_words", h.addMutedWordHandler)
+			r.Delete("/me/muted_words/{wordID}", h.removeMutedWordHandler)
+			r.Delete("/me", h.deleteAccountHandler)
+			r.Get("/me/export", h.exportAccountHandler)
+			r.Post("/me/verification", h.resendVerificationHandler)
+			r.Post("/me/2fa", h.enrollTOTPHandler)
+			r.Post("/me/2fa/confirm", h.confirmTOTPHandler)
+			r.Delete("/me/2fa", h.disableTOTPHandler)
+			r.Get("/me/identities", h.getIdentitiesHandler)
+			r.Post("/me/identities/{provider}", h.linkIdentityHandler)
+			r.Delete("/me/identities/{provider}", h.unlinkIdentityHandler)
+			r.Post("/password_reset", h.requestPasswordResetHandler)
+			r.Post("/password_reset/confirm", h.confirmPasswordResetHandler)
 		})
 
 	})
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+const oidcCookieName = "oidc_state"
+
+type oidcAuthURLOutput struct {
+	URL string `json:"url"`
+}
+
+// setOIDCCookie binds a sign in to the browser that started it, the callback only accepts the state kept in it.
+func (h *handler) setOIDCCookie(w http.ResponseWriter, req service.OIDCAuthRequest) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    req.State + "." + req.Nonce,
+		Path:     "/oauth/",
+		MaxAge:   int(service.OIDCStateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.Origin, "https://"),
+		SameSite: http.SameSiteLaxMode, //lax so it comes along the top level redirect from the provider
+	})
+}
+
+// oidcCookie reads and clears the cookie set by setOIDCCookie, ok is false when it does not hold state.
+func (h *handler) oidcCookie(w http.ResponseWriter, r *http.Request, state string) (nonce string, ok bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Path:     "/oauth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.Origin, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	c, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.SplitN(c.Value, ".", 2)
+	if len(parts) != 2 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		return "", false
+	}
+	return parts[1], true
+}
+
+//redirect to the sign in provider
+func (h *handler) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := h.OIDCAuthURL(r.Context(), chi.URLParam(r, "provider"))
+	if err == service.ErrProviderNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	h.setOIDCCookie(w, req)
+	http.Redirect(w, r, req.URL, http.StatusFound)
+}
+
+//sign in provider callback handler
+func (h *handler) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, e, http.StatusUnauthorized)
+		return
+	}
+	if q.Get("state") == "" || q.Get("code") == "" {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	nonce, ok := h.oidcCookie(w, r, q.Get("state"))
+	if !ok {
+		http.Error(w, service.ErrInvalidOIDCState.Error(), http.StatusUnauthorized)
+		return
+	}
+	out, err := h.OIDCCallback(r.Context(), chi.URLParam(r, "provider"), q.Get("state"), nonce, q.Get("code"))
+	if err == service.ErrProviderNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrInvalidOIDCState || err == service.ErrOIDCEmailNotVerified {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrIdentityTaken || err == service.ErrProviderAlreadyLinked || err == service.ErrOIDCLinkRequired {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//get linked identities handler
+func (h *handler) getIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.Identities(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//link identity handler, returns the provider url the client should open
+func (h *handler) linkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(service.KeyAuthUserID).(int64); !ok {
+		http.Error(w, service.ErrUnAuthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+	req, err := h.OIDCAuthURL(r.Context(), chi.URLParam(r, "provider"))
+	if err == service.ErrProviderNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	h.setOIDCCookie(w, req)
+	response(w, oidcAuthURLOutput{URL: req.URL}, http.StatusOK)
+}
+
+//unlink identity handler
+func (h *handler) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.UnlinkIdentity(r.Context(), chi.URLParam(r, "provider"))
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrIdentityNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
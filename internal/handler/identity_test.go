@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+	"github.com/paritoshyadav/socialnetwork/internal/service/oidc"
+)
+
+// mockCallback signs in with a mock issuer and returns the url it sends the browser back to.
+func mockCallback(t *testing.T, s *service.Service, state, nonce string) string {
+	t.Helper()
+	m, err := oidc.NewMockIssuer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	m.URL = srv.URL
+
+	p, err := oidc.Discover(context.Background(), oidc.Config{Name: "mock", Issuer: m.URL, ClientID: "client", ClientSecret: "secret"}, s.Origin+"/oauth/mock/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.OIDCProviders["mock"] = p
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(p.AuthCodeURL(state, nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.RequestURI()
+}
+
+func TestOIDCCallbackNeedsStateCookie(t *testing.T) {
+	s := service.New(nil, nil, nil, "https://example.com")
+	h := New(s)
+	callback := mockCallback(t, s, "state", "nonce")
+
+	cookies := map[string]*http.Cookie{
+		"missing":   nil,
+		"other":     {Name: oidcCookieName, Value: "other-state.nonce"},
+		"malformed": {Name: oidcCookieName, Value: "state"},
+	}
+	for name, c := range cookies {
+		req := httptest.NewRequest(http.MethodGet, callback, nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), service.ErrInvalidOIDCState.Error()) {
+			t.Errorf("%s cookie: %d %s, want %d", name, rec.Code, rec.Body, http.StatusUnauthorized)
+		}
+		cleared := rec.Result().Cookies()
+		if len(cleared) != 1 || cleared[0].Name != oidcCookieName || cleared[0].MaxAge >= 0 {
+			t.Errorf("%s cookie: state cookie not cleared, got %v", name, cleared)
+		}
+	}
+}
+
+func TestOIDCCookieAttributes(t *testing.T) {
+	h := &handler{service.New(nil, nil, nil, "https://example.com")}
+	rec := httptest.NewRecorder()
+	h.setOIDCCookie(rec, service.OIDCAuthRequest{URL: "https://issuer", State: "state", Nonce: "nonce"})
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	c := cookies[0]
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/oauth/" {
+		t.Fatalf("cookie = %+v", c)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/mock/callback?state=state&code=code", nil)
+	req.AddCookie(c)
+	nonce, ok := h.oidcCookie(httptest.NewRecorder(), req, "state")
+	if !ok || nonce != "nonce" {
+		t.Fatalf("oidcCookie = %q, %v, want %q, true", nonce, ok, "nonce")
+	}
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type createListInput struct {
+	Name        string  `json:"name" validate:"required,max=50"`
+	Description *string `json:"description" validate:"omitempty,max=160"`
+	IsPrivate   bool    `json:"is_private"`
+}
+
+type addListMemberInput struct {
+	Username string `json:"username" validate:"required,alphanum"`
+	Notify   bool   `json:"notify"`
+}
+
+// listError writes the response of the errors shared by the list handlers, reporting if it did.
+func listError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case service.ErrUnAuthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case service.ErrValidations:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case service.ErrListNotFound, service.ErrListMemberNotFound, service.ErrUserNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case service.ErrListOwner, service.ErrUserBlocked:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case service.ErrListNameTaken:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		responseError(w, err)
+	}
+	return true
+}
+
+//create list handler
+func (h *handler) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var in createListInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.CreateList(r.Context(), in.Name, in.Description, in.IsPrivate)
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusCreated)
+}
+
+//get list handler
+func (h *handler) getListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.List(r.Context(), listID)
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//delete list handler
+func (h *handler) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.DeleteList(r.Context(), listID)
+	if listError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//get lists of a user handler
+func (h *handler) getUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.ListsByUser(r.Context(), username)
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//get subscribed lists handler
+func (h *handler) getSubscribedListsHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.SubscribedLists(r.Context())
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//get list members handler
+func (h *handler) getListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var first int
+	if v := q.Get("first"); v != "" {
+		if first, err = strconv.Atoi(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	out, err := h.ListMembers(r.Context(), listID, first, q.Get("after"))
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//add list member handler
+func (h *handler) addListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var in addListMemberInput
+	err = json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.AddListMember(r.Context(), listID, in.Username, in.Notify)
+	if listError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//remove list member handler
+func (h *handler) removeListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := chi.URLParam(r, "username")
+	err = ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.RemoveListMember(r.Context(), listID, username)
+	if listError(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//toggle list subscription handler
+func (h *handler) toggleListSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.ToggleListSubscription(r.Context(), listID)
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//list timeline handler
+func (h *handler) getListTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	last, err := strconv.Atoi(q.Get("last"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.ListTimeline(r.Context(), listID, last, q.Get("before"))
+	if listError(w, err) {
+		return
+	}
+	response(w, out, http.StatusOK)
+}
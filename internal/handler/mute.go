@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type muteInput struct {
+	ExpiresIn *int64 `json:"expires_in" validate:"omitempty,min=60"` //seconds, omitted for a permanent mute
+}
+
+type mutedWordInput struct {
+	Phrase    string `json:"phrase" validate:"required,max=100"`
+	ExpiresIn *int64 `json:"expires_in" validate:"omitempty,min=60"`
+}
+
+func expiresIn(seconds *int64) *time.Duration {
+	if seconds == nil {
+		return nil
+	}
+	d := time.Duration(*seconds) * time.Second
+	return &d
+}
+
+//mute user handler, the body is optional
+func (h *handler) muteHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	var in muteInput
+	defer r.Body.Close()
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.Mute(r.Context(), username, expiresIn(in.ExpiresIn))
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrInvalidMute || err == service.ErrInvalidMuteExpiry {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//unmute user handler
+func (h *handler) unmuteHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.Unmute(r.Context(), username)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//get muted users handler
+func (h *handler) getMutesHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.Mutes(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//get muted words handler
+func (h *handler) getMutedWordsHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.MutedWords(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//add muted word handler
+func (h *handler) addMutedWordHandler(w http.ResponseWriter, r *http.Request) {
+	var in mutedWordInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.AddMutedWord(r.Context(), in.Phrase, expiresIn(in.ExpiresIn))
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrValidations || err == service.ErrInvalidMuteExpiry {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == service.ErrMutedWordDuplicate {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusCreated)
+}
+
+//remove muted word handler
+func (h *handler) removeMutedWordHandler(w http.ResponseWriter, r *http.Request) {
+	wordID, err := strconv.ParseInt(chi.URLParam(r, "wordID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.RemoveMutedWord(r.Context(), wordID)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrMutedWordNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type passwordResetInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type passwordResetConfirmInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
+}
+
+type changePasswordInput struct {
+	CurrentPassword *string `json:"current_password" validate:"omitempty,max=128"`
+	NewPassword     string  `json:"new_password" validate:"required,min=8,max=128"`
+}
+
+//request password reset handler
+func (h *handler) requestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var in passwordResetInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.RequestPasswordReset(r.Context(), in.Email)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//confirm password reset handler
+func (h *handler) confirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var in passwordResetConfirmInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.ResetPassword(r.Context(), in.Token, in.Password)
+	if err == service.ErrInvalidResetToken {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//change password handler
+func (h *handler) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var in changePasswordInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.ChangePassword(r.Context(), in.CurrentPassword, in.NewPassword)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrWrongCurrentPassword {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// passwordResetForm posts the token of the link and the new password to the confirm endpoint,
+// front ends replace it with their own page through Service.PasswordResetURL.
+const passwordResetForm = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your password</title></head>
+<body>
+<form id="reset">
+<label>New password <input type="password" name="password" minlength="8" maxlength="128" required autocomplete="new-password"></label>
+<button>Reset password</button>
+</form>
+<p id="status"></p>
+<script>
+document.getElementById("reset").addEventListener("submit", function (e) {
+	e.preventDefault();
+	var token = new URLSearchParams(location.search).get("token");
+	fetch("/api/users/password_reset/confirm", {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({token: token, password: e.target.password.value})
+	}).then(function (res) {
+		document.getElementById("status").textContent = res.ok ? "Your password was reset, you can log in now." : "This link is invalid or expired.";
+	});
+});
+</script>
+</body>
+</html>
+`
+
+//password reset page handler
+func (h *handler) passwordResetPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	//keeps the token of the url out of the referer of anything the page loads
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Write([]byte(passwordResetForm))
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+func TestPasswordResetPage(t *testing.T) {
+	s := service.New(nil, nil, nil, "https://example.com")
+	if s.PasswordResetURL != "https://example.com/password_reset" {
+		t.Fatalf("default reset url = %q", s.PasswordResetURL)
+	}
+
+	rec := httptest.NewRecorder()
+	New(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/password_reset?token=abc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("content type = %q", ct)
+	}
+	if rec.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Fatal("the token of the url could leak through the referer")
+	}
+	if !strings.Contains(rec.Body.String(), "/api/users/password_reset/confirm") {
+		t.Fatal("the page does not post to the confirm endpoint")
+	}
+}
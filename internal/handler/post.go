@@ -18,6 +18,12 @@ type CreatePostInput struct {
 	NSFW      bool    `json:"nsfw"`
 }
 
+type updatePostInput struct {
+	Content   *string `json:"content" validate:"omitempty,max=100"`
+	SpoilerOf *string `json:"spoiler_of" validate:"omitempty,max=50"`
+	NSFW      *bool   `json:"nsfw"`
+}
+
 // handler createpost
 
 func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +53,10 @@ func (h *handler) createPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if err == service.ErrEmailNotVerified {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err != nil {
 		responseError(w, err)
@@ -76,6 +86,10 @@ func (h *handler) toggleLikePostHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		responseError(w, err)
 		return
@@ -100,6 +114,10 @@ func (h *handler) togglePostSubscriptionHandler(w http.ResponseWriter, r *http.R
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		responseError(w, err)
 		return
@@ -133,8 +151,8 @@ func (h *handler) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	if err == service.ErrUserNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 	if err != nil {
@@ -169,3 +187,99 @@ func (h *handler) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	response(w, out, http.StatusOK)
 }
+
+// update post handler, fields missing from the body are left untouched
+func (h *handler) updatePostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	var in updatePostInput
+	err = json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.UpdatePost(ctx, postID, service.UpdatePostInput{
+		Content:   in.Content,
+		SpoilerOf: in.SpoilerOf,
+		NSFW:      in.NSFW,
+	})
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrValidations {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrNotPostAuthor || err == service.ErrPostEditWindowEnded {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//get post revisions handler
+func (h *handler) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.PostRevisions(ctx, postID)
+	if err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//delete post handler
+func (h *handler) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.DeletePost(ctx, postID)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrPostNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrNotPostAuthor {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+func TestPostHandlersMalformedID(t *testing.T) {
+	h := New(service.New(nil, nil, nil, "https://example.com"))
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPatch, "/api/posts/abc", strings.NewReader(`{"nsfw": true}`)),
+		httptest.NewRequest(http.MethodGet, "/api/posts/abc/revisions", nil),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || strings.TrimSpace(rec.Body.String()) != service.ErrValidations.Error() {
+			t.Errorf("%s %s: %d %q", req.Method, req.URL.Path, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type updateProfileInput struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=160"`
+	Website     *string `json:"website" validate:"omitempty,max=100"`
+	Location    *string `json:"location" validate:"omitempty,max=50"`
+}
+
+// update profile handler, fields missing from the body are left untouched
+func (h *handler) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var in updateProfileInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.UpdateProfile(r.Context(), service.UpdateProfileInput{
+		DisplayName: in.DisplayName,
+		Bio:         in.Bio,
+		Website:     in.Website,
+		Location:    in.Location,
+	})
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrValidations || err == service.ErrInvalidWebsite {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
@@ -0,0 +1,15 @@
+package handler
+
+import "testing"
+
+func TestUpdateProfileInputClearsWebsite(t *testing.T) {
+	empty := ""
+	if err := ValidateInput(updateProfileInput{Website: &empty}); err != nil {
+		t.Fatalf("empty website rejected: %v", err)
+	}
+	//the scheme is checked by the service so the error says what is wrong
+	notURL := "example.com"
+	if err := ValidateInput(updateProfileInput{Website: &notURL}); err != nil {
+		t.Fatalf("website rejected before reaching the service: %v", err)
+	}
+}
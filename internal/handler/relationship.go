@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+//mutual followers handler
+func (h *handler) mutualsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	username := chi.URLParam(r, "username")
+	err := ValidateUsername(username)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	var first int
+	if v := q.Get("first"); v != "" {
+		if first, err = strconv.Atoi(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	out, err := h.Mutuals(r.Context(), username, first, q.Get("after"))
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+//batch relationships handler, usernames are comma separated
+func (h *handler) relationshipsHandler(w http.ResponseWriter, r *http.Request) {
+	usernames := []string{}
+	for _, username := range strings.Split(r.URL.Query().Get("usernames"), ",") {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+		if err := ValidateUsername(username); err != nil {
+			http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+			return
+		}
+		usernames = append(usernames, username)
+	}
+	out, err := h.Relationships(r.Context(), usernames)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrValidations {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
+)
+
+// contentAddressed matches uploads named after a fresh nanoid, "V1StGXR8_Z5jdHi6B-myT-48.png",
+// they are never overwritten so clients can cache them forever.
+var contentAddressed = regexp.MustCompile(`(^|/)[A-Za-z0-9_-]{21}(-\d+)?\.[a-z0-9]+$`)
+
+// staticHandler serves uploaded files from the storage at /img/{name}.
+func (h *handler) staticHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := cleanStaticName(chi.URLParam(r, "*"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := h.Storage.Open(r.Context(), name)
+	if err == storage.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	defer f.Close()
+
+	content, etag, modtime, err := seekableContent(f)
+	if err == storage.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	//sniff the content instead of trusting the extension chosen at upload time
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(content, head)
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") && !strings.HasPrefix(contentType, "audio/") {
+		//never render uploaded html or scripts on our origin
+		contentType = "application/octet-stream"
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", etag)
+	if contentAddressed.MatchString(name) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	//handles Range, If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, name, modtime, content)
+}
+
+// cleanStaticName rejects traversal and hidden files like the temporary ones of a running upload.
+func cleanStaticName(name string) (string, bool) {
+	if name == "" || strings.Contains(name, "\\") || strings.ContainsRune(name, 0) {
+		return "", false
+	}
+	clean := path.Clean("/" + name)
+	if clean != "/"+name {
+		return "", false
+	}
+	for _, part := range strings.Split(clean[1:], "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	return clean[1:], true
+}
+
+// seekableContent uses the file as is when it is on disk, other storages are buffered in memory.
+func seekableContent(f io.Reader) (io.ReadSeeker, string, time.Time, error) {
+	if file, ok := f.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, "", time.Time{}, fmt.Errorf("could not stat file: %v", err)
+		}
+		if info.IsDir() {
+			return nil, "", time.Time{}, storage.ErrNotFound
+		}
+		etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+		return file, etag, info.ModTime(), nil
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("could not read file: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return bytes.NewReader(b), fmt.Sprintf(`"%x"`, sum[:16]), time.Time{}, nil
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+//who to follow suggestions handler
+func (h *handler) suggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var first int
+	if v := r.URL.Query().Get("first"); v != "" {
+		var err error
+		if first, err = strconv.Atoi(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	out, err := h.Suggestions(r.Context(), first)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type totpCodeInput struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type verifyMFAInput struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+//enroll totp handler
+func (h *handler) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := h.EnrollTOTP(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrTOTPAlreadyEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusCreated)
+}
+
+//confirm totp handler
+func (h *handler) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var in totpCodeInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.ConfirmTOTP(r.Context(), in.Code)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrTOTPAlreadyEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == service.ErrTOTPNotEnrolled || err == service.ErrInvalidMFACode {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//disable totp handler
+func (h *handler) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var in totpCodeInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.DisableTOTP(r.Context(), in.Code)
+	if err == service.ErrMFALocked {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrTOTPNotEnrolled || err == service.ErrInvalidMFACode {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//verify mfa handler, second step of login
+func (h *handler) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var in verifyMFAInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	code, recovery := in.Code, false
+	if in.RecoveryCode != "" {
+		code, recovery = in.RecoveryCode, true
+	}
+	lo, err := h.VerifyMFA(r.Context(), in.MFAToken, code, recovery)
+	if err == service.ErrMFALocked {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err == service.ErrInvalidMFAToken || err == service.ErrInvalidMFACode || err == service.ErrTOTPNotEnrolled {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, lo, http.StatusOK)
+}
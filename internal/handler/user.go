@@ -2,7 +2,6 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
 
@@ -11,8 +10,9 @@ import (
 )
 
 type createUserInfoRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Username string `json:"username" validate:"required,alphanum"`
+	Email    string  `json:"email" validate:"required,email"`
+	Username string  `json:"username" validate:"required,alphanum"`
+	Password *string `json:"password" validate:"omitempty,min=8,max=128"`
 }
 
 func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
@@ -28,7 +28,7 @@ func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
 		return
 	}
-	err = h.CreateUser(r.Context(), userInput.Email, userInput.Username)
+	err = h.CreateUser(r.Context(), userInput.Email, userInput.Username, userInput.Password)
 	if err == service.ErrEmailTaken || err == service.ErrUsernameTaken {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -55,6 +55,14 @@ func (h *handler) toggleFollow(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrUserBlocked {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -79,6 +87,10 @@ func (h *handler) userProfile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
@@ -103,17 +115,44 @@ func (h *handler) updateAvatar(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
+	if err == service.ErrImageTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 
 	if err != nil {
 		responseError(w, err)
 		return
 
 	}
-	fmt.Fprint(w, out)
-	// response(w, out, http.StatusOK)
+	response(w, out, http.StatusOK)
 
 }
 
+func (h *handler) updateBanner(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxBannerBytes)
+	defer r.Body.Close()
+	out, err := h.UpdateBanner(ctx, r.Body)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUnSpportedAvatarFormat {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err == service.ErrImageTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
 func (h *handler) searchUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	q := r.URL.Query()
@@ -126,6 +165,10 @@ func (h *handler) searchUser(w http.ResponseWriter, r *http.Request) {
 	after := q.Get("after")
 
 	profiles, err := h.Users(ctx, search, first, after)
+	if err == service.ErrInvalidCursor {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -154,6 +197,14 @@ func (h *handler) followers(w http.ResponseWriter, r *http.Request) {
 	after := q.Get("after")
 
 	profiles, err := h.UserFollowers(ctx, username, first, after)
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -181,6 +232,14 @@ func (h *handler) followings(w http.ResponseWriter, r *http.Request) {
 	after := q.Get("after")
 
 	profiles, err := h.UserFollowings(ctx, username, first, after)
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrPrivateAccount {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+type changeUsernameInput struct {
+	Username string `json:"username" validate:"required,alphanum"`
+}
+
+// change username handler
+func (h *handler) changeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	var in changeUsernameInput
+	err := json.NewDecoder(r.Body).Decode(&in)
+	defer r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ValidateInput(in)
+	if err != nil {
+		http.Error(w, service.ErrValidations.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := h.ChangeUsername(r.Context(), in.Username)
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrUsernameTaken || err == service.ErrUsernameUnchanged {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == service.ErrUsernameChangeCooldown {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	response(w, out, http.StatusOK)
+}
+
+// withRenamedRedirect sends requests for a username given up by a recent rename
+// to the same /users/{username} path under the new username.
+func (h *handler) withRenamedRedirect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+		if ValidateUsername(username) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		current, err := h.RenamedUsername(r.Context(), username)
+		if err != nil || current == username {
+			next.ServeHTTP(w, r)
+			return
+		}
+		segment := "/users/" + username
+		i := strings.Index(r.URL.Path, segment)
+		if i == -1 || (len(r.URL.Path) > i+len(segment) && r.URL.Path[i+len(segment)] != '/') {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u := *r.URL
+		u.Path = r.URL.Path[:i] + "/users/" + current + r.URL.Path[i+len(segment):]
+		u.RawPath = ""
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
+}
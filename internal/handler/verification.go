@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service"
+)
+
+//verify email handler, target of the link in the verification email
+func (h *handler) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	uid, err := strconv.ParseInt(q.Get("uid"), 10, 64)
+	if err != nil {
+		http.Error(w, service.ErrInvalidVerificationLink.Error(), http.StatusBadRequest)
+		return
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		http.Error(w, service.ErrInvalidVerificationLink.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.VerifyEmail(r.Context(), uid, expires, q.Get("signature"))
+	if err == service.ErrInvalidVerificationLink {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//resend verification email handler
+func (h *handler) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.ResendVerification(r.Context())
+	if err == service.ErrUnAuthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == service.ErrEmailAlreadyVerified {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == service.ErrVerificationThrottled {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
+)
+
+// DeleteAccount erases the auth user and everything they created,
+// fixing the counters of the posts, comments and users they interacted with.
+func (s *Service) DeleteAccount(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the delete account transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var avatar, banner sql.NullString
+	query := "SELECT avatar, banner FROM users WHERE id = $1"
+	err = tx.QueryRow(ctx, query, uid).Scan(&avatar, &banner)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user: %v", err)
+	}
+
+	steps := []struct {
+		query string
+		what  string
+	}{
+		//likes and comments on other people's posts, counters first
+		{"UPDATE posts SET likes_count = likes_count - 1 WHERE id IN (SELECT post_id FROM likes WHERE user_id = $1)", "decrement post likes"},
+		{"DELETE FROM likes WHERE user_id = $1", "delete likes"},
+		{"UPDATE comments SET likes_count = likes_count - 1 WHERE id IN (SELECT comment_id FROM comment_likes WHERE user_id = $1)", "decrement comment likes"},
+		{"DELETE FROM comment_likes WHERE user_id = $1", "delete comment likes"},
+		{`UPDATE posts SET comments_count = comments_count - c.n
+		FROM (SELECT post_id, count(*) AS n FROM comments WHERE user_id = $1 GROUP BY post_id) AS c
+		WHERE posts.id = c.post_id`, "decrement post comments"},
+		{"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE user_id = $1)", "delete likes of comments"},
+		{"DELETE FROM comments WHERE user_id = $1", "delete comments"},
+
+		//follows and blocks in both directions
+		{"UPDATE users SET followers_count = followers_count - 1 WHERE id IN (SELECT following_id FROM follows WHERE follower_id = $1)", "decrement followers"},
+		{"UPDATE users SET followings_count = followings_count - 1 WHERE id IN (SELECT follower_id FROM follows WHERE following_id = $1)", "decrement followings"},
+		{"DELETE FROM follows WHERE follower_id = $1 OR following_id = $1", "delete follows"},
+		{"DELETE FROM follow_requests WHERE requester_id = $1 OR target_id = $1", "delete follow requests"},
+		{"DELETE FROM blocks WHERE blocker_id = $1 OR blocked_id = $1", "delete blocks"},
+		{"DELETE FROM mutes WHERE muter_id = $1 OR muted_id = $1", "delete mutes"},
+		{"DELETE FROM muted_words WHERE user_id = $1", "delete muted words"},
+
+		//list memberships and subscriptions, then the user's own lists
+		{"UPDATE lists SET members_count = members_count - 1 WHERE id IN (SELECT list_id FROM list_members WHERE user_id = $1)", "decrement list members"},
+		{"DELETE FROM list_members WHERE user_id = $1 OR list_id IN (SELECT id FROM lists WHERE user_id = $1)", "delete list members"},
+		{"UPDATE lists SET subscribers_count = subscribers_count - 1 WHERE id IN (SELECT list_id FROM list_subscriptions WHERE user_id = $1)", "decrement list subscribers"},
+		{"DELETE FROM list_subscriptions WHERE user_id = $1 OR list_id IN (SELECT id FROM lists WHERE user_id = $1)", "delete list subscriptions"},
+		{"DELETE FROM notifications WHERE list_id IN (SELECT id FROM lists WHERE user_id = $1)", "delete list notifications"},
+		{"DELETE FROM lists WHERE user_id = $1", "delete lists"},
+
+		//the user's posts and everything hanging from them
+		{"DELETE FROM comment_likes WHERE comment_id IN (SELECT comments.id FROM comments INNER JOIN posts ON posts.id = comments.post_id WHERE posts.user_id = $1)", "delete likes of comments on posts"},
+		{"DELETE FROM comments WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete comments on posts"},
+		{"DELETE FROM likes WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete likes on posts"},
+		{"DELETE FROM post_subscriptions WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete post subscriptions"},
+		{"DELETE FROM timelines WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete timeline items"},
+		{"DELETE FROM notifications WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete notifications"},
+		{"DELETE FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)", "delete post revisions"},
+		{"DELETE FROM posts WHERE user_id = $1", "delete posts"},
+
+		//credentials
+		{"DELETE FROM login_codes WHERE user_id = $1", "delete login codes"},
+		{"DELETE FROM password_resets WHERE user_id = $1", "delete password resets"},
+		{"DELETE FROM sessions WHERE user_id = $1", "delete sessions"},
+		{"DELETE FROM api_keys WHERE user_id = $1", "delete api keys"},
+		{"DELETE FROM recovery_codes WHERE user_id = $1", "delete recovery codes"},
+		{"DELETE FROM mfa_challenges WHERE user_id = $1", "delete mfa challenges"},
+		{"DELETE FROM user_identities WHERE user_id = $1", "delete identities"},
+		{"DELETE FROM oidc_states WHERE user_id = $1", "delete oidc states"},
+		{"DELETE FROM username_history WHERE user_id = $1", "delete username history"},
+	}
+	for _, step := range steps {
+		if _, err = tx.Exec(ctx, step.query, uid); err != nil {
+			return fmt.Errorf("could not %s: %v", step.what, err)
+		}
+	}
+
+	//notifications of other users name the deleted user as actor
+	query = "UPDATE notifications SET actor_ids = array_remove(actor_ids, $1::INT) WHERE $1::INT = any(actor_ids)"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not remove user from notification actors: %v", err)
+	}
+	query = "DELETE FROM notifications WHERE array_length(actor_ids, 1) IS NULL"
+	if _, err = tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("could not delete notifications without actors: %v", err)
+	}
+
+	query = "DELETE FROM users WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not delete user: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the delete account transcation, error: %v", err)
+	}
+
+	if avatar.Valid {
+		if err = s.removeAvatarFiles(ctx, avatar.String); err != nil {
+			log.Printf("could not remove avatar of deleted user: %v", err)
+		}
+	}
+	if banner.Valid {
+		if err = s.Storage.Delete(ctx, bannersDir+"/"+banner.String); err != nil {
+			log.Printf("could not remove banner of deleted user: %v", err)
+		}
+	}
+
+	return nil
+}
+
+type exportProfile struct {
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	Avatar          *string    `json:"avatar"`
+	Banner          *string    `json:"banner"`
+	DisplayName     *string    `json:"display_name"`
+	Bio             *string    `json:"bio"`
+	Website         *string    `json:"website"`
+	Location        *string    `json:"location"`
+	FollowersCount  int        `json:"followers_count"`
+	FollowingsCount int        `json:"followings_count"`
+	VerifiedAt      *time.Time `json:"verified_at"`
+}
+
+type exportPost struct {
+	ID            int64     `json:"id"`
+	Content       string    `json:"content"`
+	SpoilerOf     *string   `json:"spoiler_of"`
+	NSFW          bool      `json:"nsfw"`
+	LikesCount    int       `json:"likes_count"`
+	CommentsCount int       `json:"comments_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type exportComment struct {
+	ID         int64     `json:"id"`
+	PostID     int64     `json:"post_id"`
+	Content    string    `json:"content"`
+	LikesCount int       `json:"likes_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type exportData struct {
+	Profile       exportProfile   `json:"profile"`
+	Posts         []exportPost    `json:"posts"`
+	Comments      []exportComment `json:"comments"`
+	LikedPosts    []int64         `json:"liked_posts"`
+	LikedComments []int64         `json:"liked_comments"`
+	Followers     []string        `json:"followers"`
+	Followings    []string        `json:"followings"`
+	ExportedAt    time.Time       `json:"exported_at"`
+}
+
+// ExportAccount writes a zip archive with a data.json of everything the auth user created plus their avatar and banner.
+func (s *Service) ExportAccount(ctx context.Context, w io.Writer) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	data := exportData{
+		Posts:         []exportPost{},
+		Comments:      []exportComment{},
+		LikedPosts:    []int64{},
+		LikedComments: []int64{},
+		Followers:     []string{},
+		Followings:    []string{},
+		ExportedAt:    s.Clock().UTC(),
+	}
+
+	p := &data.Profile
+	query := "SELECT id, email, username, avatar, banner, display_name, bio, website, location, followers_count, followings_count, verified_at FROM users WHERE id = $1"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&p.ID, &p.Email, &p.Username, &p.Avatar, &p.Banner, &p.DisplayName, &p.Bio, &p.Website, &p.Location, &p.FollowersCount, &p.FollowingsCount, &p.VerifiedAt)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user: %v", err)
+	}
+
+	query = "SELECT id, content, spoiler, nsfw, likes_count, comments_count, created_at, updated_at FROM posts WHERE user_id = $1 ORDER BY id"
+	err = s.exportRows(ctx, query, uid, func(rows pgx.Rows) error {
+		var post exportPost
+		if err := rows.Scan(&post.ID, &post.Content, &post.SpoilerOf, &post.NSFW, &post.LikesCount, &post.CommentsCount, &post.CreatedAt, &post.UpdatedAt); err != nil {
+			return err
+		}
+		data.Posts = append(data.Posts, post)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not export posts: %v", err)
+	}
+
+	query = "SELECT id, post_id, content, likes_count, created_at FROM comments WHERE user_id = $1 ORDER BY id"
+	err = s.exportRows(ctx, query, uid, func(rows pgx.Rows) error {
+		var c exportComment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.LikesCount, &c.CreatedAt); err != nil {
+			return err
+		}
+		data.Comments = append(data.Comments, c)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not export comments: %v", err)
+	}
+
+	ids := func(dst *[]int64) func(rows pgx.Rows) error {
+		return func(rows pgx.Rows) error {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			*dst = append(*dst, id)
+			return nil
+		}
+	}
+	names := func(dst *[]string) func(rows pgx.Rows) error {
+		return func(rows pgx.Rows) error {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			*dst = append(*dst, name)
+			return nil
+		}
+	}
+	if err = s.exportRows(ctx, "SELECT post_id FROM likes WHERE user_id = $1 ORDER BY post_id", uid, ids(&data.LikedPosts)); err != nil {
+		return fmt.Errorf("could not export likes: %v", err)
+	}
+	if err = s.exportRows(ctx, "SELECT comment_id FROM comment_likes WHERE user_id = $1 ORDER BY comment_id", uid, ids(&data.LikedComments)); err != nil {
+		return fmt.Errorf("could not export comment likes: %v", err)
+	}
+	if err = s.exportRows(ctx, "SELECT username FROM follows INNER JOIN users ON users.id = follows.follower_id WHERE follows.following_id = $1 ORDER BY username", uid, names(&data.Followers)); err != nil {
+		return fmt.Errorf("could not export followers: %v", err)
+	}
+	if err = s.exportRows(ctx, "SELECT username FROM follows INNER JOIN users ON users.id = follows.following_id WHERE follows.follower_id = $1 ORDER BY username", uid, names(&data.Followings)); err != nil {
+		return fmt.Errorf("could not export followings: %v", err)
+	}
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("data.json")
+	if err != nil {
+		return fmt.Errorf("could not create data.json in export: %v", err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(data); err != nil {
+		return fmt.Errorf("could not encode export data: %v", err)
+	}
+
+	if p.Avatar != nil {
+		//only the largest size in the original format, the others are derived from it
+		name := avatarFile(*p.Avatar, AvatarSizes[len(AvatarSizes)-1], "")
+		if err = s.addFileToZip(ctx, zw, avatarsDir+"/"+name, "avatar/"+name); err != nil {
+			return err
+		}
+	}
+	if p.Banner != nil {
+		if err = s.addFileToZip(ctx, zw, bannersDir+"/"+*p.Banner, "banner/"+*p.Banner); err != nil {
+			return err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("could not finish export archive: %v", err)
+	}
+	return nil
+}
+
+func (s *Service) exportRows(ctx context.Context, query string, uid int64, scan func(rows pgx.Rows) error) error {
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Service) addFileToZip(ctx context.Context, zw *zip.Writer, src, name string) error {
+	in, err := s.Storage.Open(ctx, src)
+	if err == storage.ErrNotFound {
+		log.Printf("file %s missing from export", src)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open %s for export: %v", src, err)
+	}
+	defer in.Close()
+	out, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create %s in export: %v", name, err)
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		return fmt.Errorf("could not copy %s to export: %v", name, err)
+	}
+	return nil
+}
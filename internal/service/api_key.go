@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
+)
+
+const (
+	APIKeyPrefix      = "sk_"
+	KeyAuthAPIKey key = "auth_api_key"
+)
+
+// APIKeyRouteGroups are the /api route groups a key can be restricted to.
+// Sessions and api keys themselves are never reachable with a key.
+var APIKeyRouteGroups = []string{"posts", "comments", "timeline", "notifications", "users", "relationships", "lists"}
+
+var (
+	ErrAPIKeyNotFound       = errors.New("api key not found")
+	ErrInvalidAPIKey        = errors.New("invalid or revoked api key")
+	ErrInvalidRouteGroup    = errors.New("invalid route group")
+	ErrRouteGroupNotAllowed = errors.New("api key is not allowed on this route")
+)
+
+// APIKey model
+type APIKey struct {
+	ID          int64      `json:"id"`
+	Label       string     `json:"label"`
+	Prefix      string     `json:"prefix"`
+	ReadOnly    bool       `json:"read_only"`
+	RouteGroups []string   `json:"route_groups"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+type CreateAPIKeyOutput struct {
+	APIKey
+	Key string `json:"key"` //only returned once, we store the hash
+}
+
+// AuthAPIKey is what withAuth knows about the key that authenticated a request.
+type AuthAPIKey struct {
+	ID          int64
+	RouteGroups []string
+}
+
+// Allows reports if the key may be used on the given route group, no groups means every group.
+func (k AuthAPIKey) Allows(group string) bool {
+	if !validRouteGroup(group) {
+		return false
+	}
+	if len(k.RouteGroups) == 0 {
+		return true
+	}
+	for _, g := range k.RouteGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func validRouteGroup(group string) bool {
+	for _, g := range APIKeyRouteGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey creates a personal api key for the auth user.
+func (s *Service) CreateAPIKey(ctx context.Context, label string, readOnly bool, routeGroups []string) (CreateAPIKeyOutput, error) {
+	var out CreateAPIKeyOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnAuthorized
+	}
+	if routeGroups == nil {
+		routeGroups = []string{}
+	}
+	for _, g := range routeGroups {
+		if !validRouteGroup(g) {
+			return out, ErrInvalidRouteGroup
+		}
+	}
+
+	secret, err := gonanoid.New(40)
+	if err != nil {
+		return out, fmt.Errorf("could not generate api key: %v", err)
+	}
+	out.Key = APIKeyPrefix + secret
+	out.Prefix = out.Key[:len(APIKeyPrefix)+6]
+	out.Label = label
+	out.ReadOnly = readOnly
+	out.RouteGroups = routeGroups
+
+	query := "INSERT INTO api_keys (user_id, label, prefix, key_hash, read_only, route_groups) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+	if err = s.Db.QueryRow(ctx, query, uid, label, out.Prefix, hashSecret(out.Key), readOnly, routeGroups).Scan(&out.ID, &out.CreatedAt); err != nil {
+		return out, fmt.Errorf("could not insert api key: %v", err)
+	}
+
+	return out, nil
+}
+
+// APIKeys lists the not revoked api keys of the auth user.
+func (s *Service) APIKeys(ctx context.Context) ([]APIKey, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	query := `SELECT id, label, prefix, read_only, route_groups, created_at, last_used_at FROM api_keys
+	WHERE user_id = $1 AND revoked_at IS NULL
+	ORDER BY id DESC`
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query api keys: %v", err)
+	}
+	defer rows.Close()
+
+	kk := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err = rows.Scan(&k.ID, &k.Label, &k.Prefix, &k.ReadOnly, &k.RouteGroups, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("could not scan api key: %v", err)
+		}
+		kk = append(kk, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate api key rows: %v", err)
+	}
+
+	return kk, nil
+}
+
+// LabelAPIKey renames an api key of the auth user.
+func (s *Service) LabelAPIKey(ctx context.Context, id int64, label string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "UPDATE api_keys SET label = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query, label, id, uid)
+	if err != nil {
+		return fmt.Errorf("could not update api key label: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAPIKey revokes an api key of the auth user.
+func (s *Service) RevokeAPIKey(ctx context.Context, id int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query, id, uid)
+	if err != nil {
+		return fmt.Errorf("could not revoke api key: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves a raw api key to claims and records its usage.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (codec.Claims, AuthAPIKey, error) {
+	var claims codec.Claims
+	var k AuthAPIKey
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return claims, k, ErrInvalidAPIKey
+	}
+	var readOnly bool
+	query := "UPDATE api_keys SET last_used_at = now() WHERE key_hash = $1 AND revoked_at IS NULL RETURNING id, user_id, read_only, route_groups"
+	err := s.Db.QueryRow(ctx, query, hashSecret(key)).Scan(&k.ID, &claims.UserID, &readOnly, &k.RouteGroups)
+	if err == pgx.ErrNoRows {
+		return claims, k, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return claims, k, fmt.Errorf("could not query api key: %v", err)
+	}
+
+	claims.Scopes = []string{codec.ScopeRead}
+	if !readOnly {
+		claims.Scopes = append(claims.Scopes, codec.ScopeWrite)
+	}
+	claims.IssuedAt = time.Now()
+
+	return claims, k, nil
+}
@@ -2,66 +2,100 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
+	"github.com/paritoshyadav/socialnetwork/internal/service/mailer"
 )
 
 type LoginOutput struct {
-	Token      string
-	Expiration time.Time
-	AuthUser   User
+	Token             string
+	Expiration        time.Time
+	RefreshToken      string
+	RefreshExpiration time.Time
+	AuthUser          User
+	MFARequired       bool
+	MFAToken          string
 }
 
 const (
-	TokenLifetime     = time.Hour * 24 * 14
-	KeyAuthUserID key = "auth_user_id"
+	TokenLifetime         = time.Minute * 15
+	MagicLinkLifetime     = time.Minute * 15
+	KeyAuthUserID     key = "auth_user_id"
+	KeyAuthClaims     key = "auth_claims"
 )
 
 var (
-	ErrUnAuthorized = errors.New("UnAuthorized User")
+	ErrUnAuthorized     = errors.New("UnAuthorized User")
+	ErrInvalidLoginCode = errors.New("invalid or expired login code")
+	ErrMissingScope     = errors.New("token is missing the required scope")
 )
 
 type key string
 
-// func (s *Service) AuthUserID(token string) (int64, error) {
-// 	fmt.Println("token is  :", token)
-// 	decodedToken, err := s.Codec.DecodeToString(token)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("unable to decode the token, %v", err)
-// 	}
-// 	convToken, err := strconv.ParseInt(decodedToken, 10, 64)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("unable to Convert the token, %v", err)
-// 	}
+// Login sends a single use magic link to the user with the given email.
+// Unknown emails are ignored silently so the endpoint can not be used to find registered users.
+func (s *Service) Login(ctx context.Context, email string) error {
+	var uid int64
+	query := "SELECT id FROM users WHERE email = $1"
+	err := s.Db.QueryRow(ctx, query, email).Scan(&uid)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user: %v", err)
+	}
 
-// 	return convToken, nil
+	code, err := gonanoid.New(32)
+	if err != nil {
+		return fmt.Errorf("could not generate login code: %v", err)
+	}
+
+	query = "INSERT INTO login_codes (user_id, code_hash, expires_at) VALUES ($1, $2, now() + $3::INTERVAL)"
+	if _, err = s.Db.Exec(ctx, query, uid, hashSecret(code), MagicLinkLifetime); err != nil {
+		return fmt.Errorf("could not insert login code: %v", err)
+	}
+
+	link := s.Origin + "/login/verify?code=" + code
+	err = s.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your Socially login link",
+		Body:    fmt.Sprintf("Use the link below to login, it expires in %d minutes and works only once.\n\n%s\n", int(MagicLinkLifetime.Minutes()), link),
+	})
+	if err != nil {
+		return fmt.Errorf("could not send login link: %v", err)
+	}
 
-// }
+	return nil
 
-func (s *Service) Login(ctx context.Context, email string) (LoginOutput, error) {
+}
+
+// VerifyLogin exchanges a magic link code for an auth token.
+func (s *Service) VerifyLogin(ctx context.Context, code string) (LoginOutput, error) {
 	var lo LoginOutput
-	query := "SELECT ID, email FROM users WHERE email = $1"
-	err := s.Db.QueryRow(ctx, query, email).Scan(&lo.AuthUser.ID, &lo.AuthUser.Username)
+	var uid int64
+	query := "UPDATE login_codes SET used_at = now() WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now() RETURNING user_id"
+	err := s.Db.QueryRow(ctx, query, hashSecret(code)).Scan(&uid)
 	if err == pgx.ErrNoRows {
-		return lo, ErrUserNotFound
+		return lo, ErrInvalidLoginCode
 	}
 	if err != nil {
-		return lo, fmt.Errorf("could not query the user: %v", err)
+		return lo, fmt.Errorf("could not consume login code: %v", err)
 	}
-	fmt.Println(len(strconv.FormatInt(lo.AuthUser.ID, 10)))
-	lo.Token, err = s.Codec.EncodeAuthID(lo.AuthUser.ID)
-	if err != nil {
-		return lo, err
-	}
-
-	lo.Expiration = time.Now().Add(TokenLifetime)
 
-	return lo, nil
+	//the link reached the inbox so the email is verified as well
+	query = "UPDATE users SET verified_at = now() WHERE id = $1 AND verified_at IS NULL"
+	if _, err = s.Db.Exec(ctx, query, uid); err != nil {
+		return lo, fmt.Errorf("could not verify email after login: %v", err)
+	}
 
+	return s.completeLogin(ctx, uid)
 }
 
 func (s *Service) AuthUser(ctx context.Context) (User, error) {
@@ -76,3 +110,15 @@ func (s *Service) AuthUser(ctx context.Context) (User, error) {
 	return s.UserById(ctx, uid)
 
 }
+
+// AuthClaims returns the full claim set of the token that authenticated the request.
+func AuthClaims(ctx context.Context) (codec.Claims, bool) {
+	claims, ok := ctx.Value(KeyAuthClaims).(codec.Claims)
+	return claims, ok
+}
+
+// hashSecret returns the hex encoded sha256 of a random secret so only hashes are stored
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
+	"github.com/paritoshyadav/socialnetwork/internal/service/webp"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxImagePixels caps the canvas of uploaded images, a few kilobytes can declare
+// dimensions that would take gigabytes of memory to decode.
+const MaxImagePixels = 4096 * 4096
+
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+// AvatarSizes are the square sizes in pixels generated for every uploaded avatar.
+var AvatarSizes = []int{48, 128, 400}
+
+// AvatarURL points to one size of an avatar in its original format and in webp.
+type AvatarURL struct {
+	URL  string `json:"url"`
+	WebP string `json:"webp"`
+}
+
+// AvatarURLs maps the avatar size to its urls.
+type AvatarURLs map[int]AvatarURL
+
+// avatarURLs builds the urls of every size of the stored avatar, nil when the user has none.
+func (s *Service) avatarURLs(avatar sql.NullString) AvatarURLs {
+	if !avatar.Valid {
+		return nil
+	}
+	urls := make(AvatarURLs, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		urls[size] = AvatarURL{
+			URL:  s.Storage.URL(avatarsDir + "/" + avatarFile(avatar.String, size, "")),
+			WebP: s.Storage.URL(avatarsDir + "/" + avatarFile(avatar.String, size, "webp")),
+		}
+	}
+	return urls
+}
+
+// avatarFile names one size of an avatar stored as "<id>.<ext>", an empty ext keeps the original one.
+func avatarFile(avatar string, size int, ext string) string {
+	name := strings.TrimSuffix(avatar, path.Ext(avatar))
+	if ext == "" {
+		ext = strings.TrimPrefix(path.Ext(avatar), ".")
+	}
+	return name + "-" + strconv.Itoa(size) + "." + ext
+}
+
+// avatarFiles lists every file generated for an avatar, and the single original
+// file kept by avatars uploaded before the sizes existed.
+func avatarFiles(avatar string) []string {
+	files := []string{avatar}
+	for _, size := range AvatarSizes {
+		files = append(files, avatarFile(avatar, size, ""))
+		if path.Ext(avatar) != ".webp" {
+			files = append(files, avatarFile(avatar, size, "webp"))
+		}
+	}
+	return files
+}
+
+// removeAvatarFiles deletes every size of an avatar from the storage.
+func (s *Service) removeAvatarFiles(ctx context.Context, avatar string) error {
+	var firstErr error
+	for _, name := range avatarFiles(avatar) {
+		if err := s.Storage.Delete(ctx, avatarsDir+"/"+name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writeAvatarSizes stores every size of the image in its format and in webp,
+// nothing is left behind on error.
+func (s *Service) writeAvatarSizes(ctx context.Context, avatar string, img image.Image, format string) error {
+	for _, size := range AvatarSizes {
+		resized := imaging.Fill(img, size, size, imaging.Center, imaging.Lanczos)
+		err := s.writeImage(ctx, avatarsDir+"/"+avatarFile(avatar, size, ""), resized, format)
+		if err == nil && format != "webp" {
+			err = s.writeImage(ctx, avatarsDir+"/"+avatarFile(avatar, size, "webp"), resized, "webp")
+		}
+		if err != nil {
+			s.removeSizedAvatarFiles(ctx, avatar)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSizedAvatarFiles deletes the generated sizes only, keeping the original of an old avatar.
+func (s *Service) removeSizedAvatarFiles(ctx context.Context, avatar string) {
+	for _, name := range avatarFiles(avatar)[1:] {
+		s.Storage.Delete(ctx, avatarsDir+"/"+name)
+	}
+}
+
+// avatarsBackfilled marks a storage whose avatars all have their sizes, hidden files are not served.
+const avatarsBackfilled = avatarsDir + "/.sizes-backfilled"
+
+// BackfillAvatarSizes generates the sizes of avatars uploaded before they existed, which only
+// stored the original file. It runs once per storage and returns how many avatars it resized.
+func (s *Service) BackfillAvatarSizes(ctx context.Context) (int, error) {
+	marker, err := s.Storage.Open(ctx, avatarsBackfilled)
+	if err == nil {
+		marker.Close()
+		return 0, nil
+	}
+	if err != storage.ErrNotFound {
+		return 0, fmt.Errorf("could not check avatar backfill: %v", err)
+	}
+
+	rows, err := s.Db.Query(ctx, "SELECT avatar FROM users WHERE avatar IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("could not query avatars: %v", err)
+	}
+	var avatars []string
+	for rows.Next() {
+		var avatar string
+		if err = rows.Scan(&avatar); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan avatar: %v", err)
+		}
+		avatars = append(avatars, avatar)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("could not iterate avatars: %v", err)
+	}
+
+	n := 0
+	for _, avatar := range avatars {
+		resized, err := s.backfillAvatar(ctx, avatar)
+		if err != nil {
+			return n, err
+		}
+		if resized {
+			n++
+		}
+	}
+	if err = s.Storage.Put(ctx, avatarsBackfilled, strings.NewReader(""), "text/plain"); err != nil {
+		return n, fmt.Errorf("could not mark avatar backfill: %v", err)
+	}
+	return n, nil
+}
+
+// backfillAvatar generates the sizes of one avatar from its original file unless they exist.
+// Missing or broken originals are logged and skipped, they would never display anyway.
+func (s *Service) backfillAvatar(ctx context.Context, avatar string) (bool, error) {
+	sized, err := s.Storage.Open(ctx, avatarsDir+"/"+avatarFile(avatar, AvatarSizes[0], ""))
+	if err == nil {
+		sized.Close()
+		return false, nil
+	}
+	if err != storage.ErrNotFound {
+		return false, fmt.Errorf("could not check avatar %s: %v", avatar, err)
+	}
+	original, err := s.Storage.Open(ctx, avatarsDir+"/"+avatar)
+	if err == storage.ErrNotFound {
+		log.Printf("avatar %s has no file to resize", avatar)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not open avatar %s: %v", avatar, err)
+	}
+	defer original.Close()
+	img, format, err := decodeImage(original, MaxAvatarBytes)
+	if err != nil {
+		log.Printf("could not resize avatar %s: %v", avatar, err)
+		return false, nil
+	}
+	if err = s.writeAvatarSizes(ctx, avatar, img, format); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// decodeImage reads a png, jpeg, gif or webp image of up to limit bytes and MaxImagePixels,
+// rotated by its exif orientation. The image is re-encoded afterwards so any exif metadata is dropped.
+func decodeImage(r io.Reader, limit int64) (image.Image, string, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read the image: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", ErrUnSpportedAvatarFormat
+	}
+	if format != "png" && format != "jpeg" && format != "gif" && format != "webp" {
+		return nil, "", ErrUnSpportedAvatarFormat
+	}
+	//checked before decoding, which allocates the whole canvas
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, "", ErrImageTooLarge
+	}
+	img, err := imaging.Decode(bytes.NewReader(b), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not decode the image: %v", err)
+	}
+	return img, format, nil
+}
+
+// writeImage stores an image encoded in the given format.
+func (s *Service) writeImage(ctx context.Context, name string, img image.Image, format string) error {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "webp":
+		err = webp.Encode(&buf, img)
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %v", name, err)
+	}
+	if err = s.Storage.Put(ctx, name, &buf, "image/"+format); err != nil {
+		return fmt.Errorf("could not store %s: %v", name, err)
+	}
+	return nil
+}
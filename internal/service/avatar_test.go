@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
+)
+
+func TestDecodeImagePixelCap(t *testing.T) {
+	//a 65535x65535 gif header with no frames, a few bytes declaring a 4 gigapixel canvas
+	bomb := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00\x3b")
+	if _, _, err := decodeImage(bytes.NewReader(bomb), MaxAvatarBytes); err != ErrImageTooLarge {
+		t.Fatalf("err = %v, want %v", err, ErrImageTooLarge)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 64, 32))); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := decodeImage(&buf, MaxAvatarBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+		t.Fatalf("decoded %s %v", format, img.Bounds())
+	}
+}
+
+func TestBackfillAvatar(t *testing.T) {
+	dir := t.TempDir()
+	s := &Service{Storage: storage.NewLocal(dir, "http://localhost/img")}
+	ctx := context.Background()
+
+	//an avatar uploaded before the sizes, only the original is stored
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Storage.Put(ctx, avatarsDir+"/legacy.png", &buf, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	resized, err := s.backfillAvatar(ctx, "legacy.png")
+	if err != nil || !resized {
+		t.Fatalf("backfillAvatar = %v, %v", resized, err)
+	}
+	for _, name := range avatarFiles("legacy.png") {
+		if _, err := os.Stat(filepath.Join(dir, avatarsDir, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+	if resized, err = s.backfillAvatar(ctx, "legacy.png"); err != nil || resized {
+		t.Fatalf("second backfillAvatar = %v, %v, want false", resized, err)
+	}
+	if resized, err = s.backfillAvatar(ctx, "missing.png"); err != nil || resized {
+		t.Fatalf("backfillAvatar of a missing file = %v, %v, want false", resized, err)
+	}
+
+	//replacing the avatar removes the original too
+	if err = s.removeAvatarFiles(ctx, "legacy.png"); err != nil {
+		t.Fatal(err)
+	}
+	left, err := filepath.Glob(filepath.Join(dir, avatarsDir, "legacy*"))
+	if err != nil || len(left) != 0 {
+		t.Fatalf("left behind %v", left)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/disintegration/imaging"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	MaxBannerBytes = 8 << 20 //8MB
+	BannerWidth    = 1500
+	BannerHeight   = 500 //3:1
+	bannersDir     = "banners"
+)
+
+// bannerURL of the stored banner, nil when the user has none.
+func (s *Service) bannerURL(banner sql.NullString) *string {
+	if !banner.Valid {
+		return nil
+	}
+	url := s.Storage.URL(bannersDir + "/" + banner.String)
+	return &url
+}
+
+// UpdateBanner crops the uploaded image to 3:1 and replaces the cover image of the auth user.
+func (s *Service) UpdateBanner(ctx context.Context, r io.Reader) (string, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return "", ErrUnAuthorized
+	}
+	img, format, err := decodeImage(r, MaxBannerBytes)
+	if err != nil {
+		return "", err
+	}
+	id, err := gonanoid.New()
+	if err != nil {
+		return "", fmt.Errorf("could not generate banner filename: %v", err)
+	}
+	banner := id + "." + format
+
+	img = imaging.Fill(img, BannerWidth, BannerHeight, imaging.Center, imaging.Lanczos)
+	if err = s.writeImage(ctx, bannersDir+"/"+banner, img, format); err != nil {
+		return "", err
+	}
+
+	var oldBanner sql.NullString
+	query := `UPDATE users SET banner = $1 WHERE id = $2
+	RETURNING (SELECT banner FROM users WHERE id = $2) AS old_banner`
+	if err = s.Db.QueryRow(ctx, query, banner, uid).Scan(&oldBanner); err != nil {
+		s.Storage.Delete(ctx, bannersDir+"/"+banner)
+		return "", fmt.Errorf("could not update banner: %v", err)
+	}
+
+	if oldBanner.Valid {
+		if err = s.Storage.Delete(ctx, bannersDir+"/"+oldBanner.String); err != nil {
+			log.Printf("could not remove old banner: %v", err)
+		}
+	}
+
+	return *s.bannerURL(sql.NullString{String: banner, Valid: true}), nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrInvalidBlock = errors.New("can not block yourself")
+	ErrUserBlocked  = errors.New("user is blocked")
+)
+
+// queryRower is satisfied by both the pool and a transaction.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Block blocks the user with the given username, removing the follows, follow requests
+// and list memberships in both directions and the notifications they caused to each other.
+func (s *Service) Block(ctx context.Context, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the block transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var blockedID int64
+	query := "SELECT id FROM users WHERE username = $1"
+	err = tx.QueryRow(ctx, query, username).Scan(&blockedID)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query id from given username, error %v", err)
+	}
+	if blockedID == uid {
+		return ErrInvalidBlock
+	}
+
+	query = "INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT (blocker_id, blocked_id) DO NOTHING"
+	commandTag, err := tx.Exec(ctx, query, uid, blockedID)
+	if err != nil {
+		return fmt.Errorf("could not insert block: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return nil
+	}
+
+	for _, pair := range [][2]int64{{uid, blockedID}, {blockedID, uid}} {
+		follower, following := pair[0], pair[1]
+		query = "UPDATE notifications SET actor_ids = array_remove(actor_ids, $2::INT) WHERE user_id = $1 AND $2::INT = any(actor_ids)"
+		if _, err = tx.Exec(ctx, query, follower, following); err != nil {
+			return fmt.Errorf("could not remove blocked user from notification actors: %v", err)
+		}
+
+		query = "UPDATE lists SET members_count = members_count - 1 WHERE user_id = $1 AND id IN (SELECT list_id FROM list_members WHERE user_id = $2)"
+		if _, err = tx.Exec(ctx, query, follower, following); err != nil {
+			return fmt.Errorf("could not update list members count: %v", err)
+		}
+		query = "DELETE FROM list_members WHERE user_id = $2 AND list_id IN (SELECT id FROM lists WHERE user_id = $1)"
+		if _, err = tx.Exec(ctx, query, follower, following); err != nil {
+			return fmt.Errorf("could not delete list member: %v", err)
+		}
+
+		query = "DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2"
+		if _, err = tx.Exec(ctx, query, follower, following); err != nil {
+			return fmt.Errorf("could not delete follow request: %v", err)
+		}
+
+		query = "DELETE FROM follows WHERE follower_id = $1 AND following_id = $2"
+		commandTag, err = tx.Exec(ctx, query, follower, following)
+		if err != nil {
+			return fmt.Errorf("could not delete follow: %v", err)
+		}
+		if commandTag.RowsAffected() == 0 {
+			continue
+		}
+		query = "UPDATE users SET followings_count = followings_count - 1 WHERE id = $1"
+		if _, err = tx.Exec(ctx, query, follower); err != nil {
+			return fmt.Errorf("could to update user following count: %v", err)
+		}
+		query = "UPDATE users SET followers_count = followers_count - 1 WHERE id = $1"
+		if _, err = tx.Exec(ctx, query, following); err != nil {
+			return fmt.Errorf("could to update user followers count: %v", err)
+		}
+	}
+	query = "DELETE FROM notifications WHERE user_id IN ($1, $2) AND array_length(actor_ids, 1) IS NULL"
+	if _, err = tx.Exec(ctx, query, uid, blockedID); err != nil {
+		return fmt.Errorf("could not delete notifications without actors: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the block transcation, error: %v", err)
+	}
+	return nil
+}
+
+// Unblock lifts a block made by the auth user, like Block it is a no-op when nothing changes.
+// Removed follows are not restored.
+func (s *Service) Unblock(ctx context.Context, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	var blockedID int64
+	query := "SELECT id FROM users WHERE username = $1"
+	err := s.Db.QueryRow(ctx, query, username).Scan(&blockedID)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query id from given username, error %v", err)
+	}
+	query = "DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2"
+	if _, err = s.Db.Exec(ctx, query, uid, blockedID); err != nil {
+		return fmt.Errorf("could not delete block: %v", err)
+	}
+	return nil
+}
+
+// blockedBetween reports if either user has blocked the other.
+func blockedBetween(ctx context.Context, q queryRower, a, b int64) (bool, error) {
+	var blocked bool
+	query := "SELECT EXISTS (SELECT 1 FROM blocks WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))"
+	if err := q.QueryRow(ctx, query, a, b).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("could not check blocks: %v", err)
+	}
+	return blocked, nil
+}
+
+// postBlocked reports if the author of the post and the user have blocked each other,
+// in which case the post behaves as if it did not exist.
+func postBlocked(ctx context.Context, q queryRower, uid, postID int64) (bool, error) {
+	var blocked bool
+	query := `SELECT EXISTS (SELECT 1 FROM posts INNER JOIN blocks
+	ON (blocks.blocker_id = posts.user_id AND blocks.blocked_id = $1) OR (blocks.blocker_id = $1 AND blocks.blocked_id = posts.user_id)
+	WHERE posts.id = $2)`
+	if err := q.QueryRow(ctx, query, uid, postID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("could not check post blocks: %v", err)
+	}
+	return blocked, nil
+}
@@ -0,0 +1,45 @@
+package codec
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var (
+	ErrTokenExpired = errors.New("token expired")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+//Claims carried by an auth token
+type Claims struct {
+	UserID    int64     `json:"uid"`
+	SessionID int64     `json:"sid"`
+	Scopes    []string  `json:"scopes"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+func (c Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// stamp fills the issued at and expiry times when the caller left them empty.
+func (c Claims) stamp(lifetime time.Duration) Claims {
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	if c.ExpiresAt.IsZero() {
+		c.ExpiresAt = c.IssuedAt.Add(lifetime)
+	}
+	return c
+}
@@ -1,50 +1,82 @@
 package codec
 
 import (
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hako/branca"
 )
 
+//Codec encodes claims in branca tokens
 type Codec struct {
-	token         string
+	ring          KeyRing
 	tokenlifetime time.Duration
 }
 
-func New(token string, tokenlifetime time.Duration) *Codec {
+func New(ring KeyRing, tokenlifetime time.Duration) *Codec {
 
-	return &Codec{token: token, tokenlifetime: tokenlifetime}
+	return &Codec{ring: ring, tokenlifetime: tokenlifetime}
 
 }
 
+//GetToken returns branca with the current key of the ring
 func (c *Codec) GetToken() *branca.Branca {
-	codec := branca.NewBranca(c.token)
+	return c.branca(c.ring.Current())
+
+}
+
+func (c *Codec) branca(k Key) *branca.Branca {
+	codec := branca.NewBranca(k.Secret)
 	codec.SetTTL(uint32(c.tokenlifetime.Seconds()))
 	return codec
-
 }
 
-func (c *Codec) EncodeAuthID(id int64) (string, error) {
-	encodeToken, err := c.GetToken().EncodeToString(strconv.FormatInt(id, 10))
+// EncodeClaims prefixes the branca token with the key id, "<kid>.<token>".
+func (c *Codec) EncodeClaims(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims.stamp(c.tokenlifetime))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %v", err)
+	}
+	encodeToken, err := c.GetToken().EncodeToString(string(payload))
 	if err != nil {
-		return "", fmt.Errorf("failed to encode id to token: %v", err)
+		return "", fmt.Errorf("failed to encode claims to token: %v", err)
 	}
-	return encodeToken, err
+	return c.ring.Current().ID + "." + encodeToken, err
 
 }
 
-func (c *Codec) DecodeAuthID(token string) (int64, error) {
-	decodedToken, err := c.GetToken().DecodeToString(token)
+func (c *Codec) DecodeClaims(token string) (Claims, error) {
+	var claims Claims
+	decodedToken, err := c.decode(token)
 	if err != nil {
-		return 0, fmt.Errorf("unable to decode the token, %v", err)
+		return claims, fmt.Errorf("unable to decode the token, %v", err)
 	}
-	convToken, err := strconv.ParseInt(decodedToken, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("unable to Convert the token, %v", err)
+	if err = json.Unmarshal([]byte(decodedToken), &claims); err != nil {
+		return claims, fmt.Errorf("unable to unmarshal the token claims, %v", err)
 	}
 
-	return convToken, nil
+	return claims, nil
+
+}
+
+// decode picks the key named in the token, tokens issued before key ids existed are tried against every key.
+func (c *Codec) decode(token string) (string, error) {
+	if i := strings.Index(token, "."); i >= 0 {
+		k, ok := c.ring.Find(token[:i])
+		if !ok {
+			return "", ErrUnknownKeyID
+		}
+		return c.branca(k).DecodeToString(token[i+1:])
+	}
 
+	var err error
+	for _, k := range c.ring {
+		var payload string
+		if payload, err = c.branca(k).DecodeToString(token); err == nil {
+			return payload, nil
+		}
+	}
+	return "", err
 }
@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//JWT encodes claims in HS256 signed json web tokens, the key id goes in the header
+type JWT struct {
+	ring          KeyRing
+	tokenlifetime time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type jwtPayload struct {
+	Sub   string `json:"sub"`
+	Sid   int64  `json:"sid"`
+	Scope string `json:"scope"`
+	Iat   int64  `json:"iat"`
+	Exp   int64  `json:"exp"`
+}
+
+func NewJWT(ring KeyRing, tokenlifetime time.Duration) *JWT {
+	return &JWT{ring: ring, tokenlifetime: tokenlifetime}
+}
+
+func (j *JWT) EncodeClaims(claims Claims) (string, error) {
+	claims = claims.stamp(j.tokenlifetime)
+	k := j.ring.Current()
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT", Kid: k.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal header: %v", err)
+	}
+	payload, err := json.Marshal(jwtPayload{
+		Sub:   strconv.FormatInt(claims.UserID, 10),
+		Sid:   claims.SessionID,
+		Scope: strings.Join(claims.Scopes, " "),
+		Iat:   claims.IssuedAt.Unix(),
+		Exp:   claims.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(jwtSign(k, signingInput)), nil
+}
+
+func (j *JWT) DecodeClaims(token string) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(b, &header); err != nil || header.Alg != "HS256" {
+		return claims, ErrInvalidToken
+	}
+	k, ok := j.ring.Find(header.Kid)
+	if !ok {
+		return claims, ErrUnknownKeyID
+	}
+	signature, err := base64.RawURLEncoding.Strict().DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, jwtSign(k, parts[0]+"."+parts[1])) {
+		return claims, ErrInvalidToken
+	}
+
+	b, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	var payload jwtPayload
+	if err = json.Unmarshal(b, &payload); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.UserID, err = strconv.ParseInt(payload.Sub, 10, 64); err != nil {
+		return claims, ErrInvalidToken
+	}
+	claims.IssuedAt = time.Unix(payload.Iat, 0).UTC()
+	claims.ExpiresAt = time.Unix(payload.Exp, 0).UTC()
+	if time.Now().After(claims.ExpiresAt) {
+		return claims, ErrTokenExpired
+	}
+	claims.SessionID = payload.Sid
+	claims.Scopes = strings.Fields(payload.Scope)
+
+	return claims, nil
+}
+
+func jwtSign(k Key, signingInput string) []byte {
+	mac := hmac.New(sha256.New, []byte(k.Secret))
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	j := NewJWT(testKeyRing(t, "a"), time.Hour)
+	in := Claims{UserID: 42, SessionID: 7, Scopes: []string{ScopeRead, ScopeWrite}}
+	token, err := j.EncodeClaims(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := j.DecodeClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.UserID != in.UserID || out.SessionID != in.SessionID || !out.HasScope(ScopeRead) || !out.HasScope(ScopeWrite) {
+		t.Fatalf("claims = %+v, want %+v", out, in)
+	}
+	if d := out.ExpiresAt.Sub(out.IssuedAt); d != time.Hour {
+		t.Fatalf("lifetime = %v, want %v", d, time.Hour)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	old := NewJWT(testKeyRing(t, "a"), time.Hour)
+	token, err := old.EncodeClaims(Claims{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := NewJWT(testKeyRing(t, "b", "a"), time.Hour)
+	if _, err = rotated.DecodeClaims(token); err != nil {
+		t.Fatalf("token of the previous key: %v", err)
+	}
+	retired := NewJWT(testKeyRing(t, "b"), time.Hour)
+	if _, err = retired.DecodeClaims(token); err != ErrUnknownKeyID {
+		t.Fatalf("token of a retired key: err = %v, want %v", err, ErrUnknownKeyID)
+	}
+}
+
+func TestJWTTampered(t *testing.T) {
+	j := NewJWT(testKeyRing(t, "a"), time.Hour)
+	token, err := j.EncodeClaims(Claims{UserID: 42, Scopes: []string{ScopeRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	payload, err := json.Marshal(jwtPayload{Sub: "1", Scope: ScopeRead + " " + ScopeWrite, Exp: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"payload":   parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2],
+		"signature": parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("not the signature")),
+		"stripped":  parts[0] + "." + parts[1] + ".",
+		"truncated": parts[0] + "." + parts[1],
+	}
+	for name, tampered := range cases {
+		if _, err = j.DecodeClaims(tampered); err != ErrInvalidToken {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestJWTAlgConfusion(t *testing.T) {
+	ring := testKeyRing(t, "a")
+	j := NewJWT(ring, time.Hour)
+	token, err := j.EncodeClaims(Claims{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	for _, alg := range []string{"none", "None", "HS512", "RS256", ""} {
+		header, err := json.Marshal(jwtHeader{Alg: alg, Typ: "JWT", Kid: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := base64.RawURLEncoding.EncodeToString(header)
+		//both unsigned and signed with the shared secret
+		for _, sig := range []string{"", base64.RawURLEncoding.EncodeToString(jwtSign(ring.Current(), h+"."+parts[1]))} {
+			if _, err = j.DecodeClaims(h + "." + parts[1] + "." + sig); err != ErrInvalidToken {
+				t.Errorf("alg %q: err = %v, want %v", alg, err, ErrInvalidToken)
+			}
+		}
+	}
+}
+
+func TestJWTExpired(t *testing.T) {
+	j := NewJWT(testKeyRing(t, "a"), time.Hour)
+	token, err := j.EncodeClaims(Claims{UserID: 42, IssuedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = j.DecodeClaims(token); err != ErrTokenExpired {
+		t.Fatalf("err = %v, want %v", err, ErrTokenExpired)
+	}
+}
@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const keySize = 32
+
+var (
+	ErrEmptyKeyRing   = errors.New("key ring has no keys")
+	ErrUnknownKeyID   = errors.New("token signed with unknown key")
+	ErrInvalidKeySpec = errors.New("invalid key spec, expected id:secret")
+)
+
+//Key used to encode and decode tokens
+type Key struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// KeyRing is ordered from newest to oldest, the first key encodes new tokens
+// and every key is still accepted for decoding until its tokens expire.
+type KeyRing []Key
+
+// ParseKeyRing reads a ring from a comma separated list of id:secret pairs, newest first.
+func ParseKeyRing(spec string) (KeyRing, error) {
+	var ring KeyRing
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, ":")
+		if i < 1 {
+			return nil, ErrInvalidKeySpec
+		}
+		ring = append(ring, Key{ID: pair[:i], Secret: pair[i+1:]})
+	}
+	return ring, ring.Validate()
+}
+
+// LoadKeyRing reads a ring from a json file shaped like {"keys": [{"id": "...", "secret": "..."}]}, newest first.
+func LoadKeyRing(path string) (KeyRing, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key ring file: %v", err)
+	}
+	var file struct {
+		Keys KeyRing `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("could not parse key ring file: %v", err)
+	}
+	return file.Keys, file.Keys.Validate()
+}
+
+func (kr KeyRing) Validate() error {
+	if len(kr) == 0 {
+		return ErrEmptyKeyRing
+	}
+	seen := map[string]struct{}{}
+	for _, k := range kr {
+		if k.ID == "" || strings.ContainsAny(k.ID, ".:, ") {
+			return fmt.Errorf("invalid key id %q", k.ID)
+		}
+		if _, ok := seen[k.ID]; ok {
+			return fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = struct{}{}
+		if len(k.Secret) != keySize {
+			return fmt.Errorf("key %q must be %d bytes long", k.ID, keySize)
+		}
+	}
+	return nil
+}
+
+//Current returns the key used to encode new tokens
+func (kr KeyRing) Current() Key {
+	return kr[0]
+}
+
+func (kr KeyRing) Find(id string) (Key, bool) {
+	for _, k := range kr {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
@@ -1,9 +1,6 @@
 package codec
 
-import "github.com/hako/branca"
-
 type CodecLayer interface {
-	GetToken() *branca.Branca
-	EncodeAuthID(id int64) (string, error)
-	DecodeAuthID(token string) (int64, error)
+	EncodeClaims(c Claims) (string, error)
+	DecodeClaims(token string) (Claims, error)
 }
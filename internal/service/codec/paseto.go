@@ -0,0 +1,223 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const pasetoHeader = "v4.local."
+
+//Paseto encodes claims in PASETO v4.local tokens, the key id goes in the footer
+type Paseto struct {
+	ring          KeyRing
+	tokenlifetime time.Duration
+}
+
+type pasetoPayload struct {
+	Sub    string   `json:"sub"`
+	Sid    int64    `json:"sid"`
+	Scopes []string `json:"scopes"`
+	Iat    string   `json:"iat"`
+	Exp    string   `json:"exp"`
+}
+
+type pasetoFooter struct {
+	Kid string `json:"kid"`
+}
+
+func NewPaseto(ring KeyRing, tokenlifetime time.Duration) *Paseto {
+	return &Paseto{ring: ring, tokenlifetime: tokenlifetime}
+}
+
+func (p *Paseto) EncodeClaims(claims Claims) (string, error) {
+	claims = claims.stamp(p.tokenlifetime)
+	m, err := json.Marshal(pasetoPayload{
+		Sub:    fmt.Sprint(claims.UserID),
+		Sid:    claims.SessionID,
+		Scopes: claims.Scopes,
+		Iat:    claims.IssuedAt.Format(time.RFC3339),
+		Exp:    claims.ExpiresAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %v", err)
+	}
+	k := p.ring.Current()
+	f, err := json.Marshal(pasetoFooter{Kid: k.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal footer: %v", err)
+	}
+
+	n := make([]byte, 32)
+	if _, err = rand.Read(n); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return pasetoEncrypt([]byte(k.Secret), n, m, f, nil)
+}
+
+func (p *Paseto) DecodeClaims(token string) (Claims, error) {
+	var claims Claims
+	body, f, err := pasetoSplit(token)
+	if err != nil {
+		return claims, err
+	}
+	var footer pasetoFooter
+	if err = json.Unmarshal(f, &footer); err != nil {
+		return claims, ErrInvalidToken
+	}
+	k, ok := p.ring.Find(footer.Kid)
+	if !ok {
+		return claims, ErrUnknownKeyID
+	}
+	m, err := pasetoDecrypt([]byte(k.Secret), body, f, nil)
+	if err != nil {
+		return claims, err
+	}
+
+	var payload pasetoPayload
+	if err = json.Unmarshal(m, &payload); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if _, err = fmt.Sscan(payload.Sub, &claims.UserID); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.IssuedAt, err = time.Parse(time.RFC3339, payload.Iat); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if claims.ExpiresAt, err = time.Parse(time.RFC3339, payload.Exp); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().After(claims.ExpiresAt) {
+		return claims, ErrTokenExpired
+	}
+	claims.SessionID = payload.Sid
+	claims.Scopes = payload.Scopes
+
+	return claims, nil
+}
+
+// pasetoEncrypt builds a v4.local token of the message m with footer f,
+// n is the random 32 byte nonce and i the implicit assertion.
+func pasetoEncrypt(key, n, m, f, i []byte) (string, error) {
+	ek, n2, ak, err := pasetoSplitKey(key, n)
+	if err != nil {
+		return "", err
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %v", err)
+	}
+	c := make([]byte, len(m))
+	cipher.XORKeyStream(c, m)
+
+	t, err := pasetoMAC(ak, n, c, f, i)
+	if err != nil {
+		return "", err
+	}
+
+	body := append(append(append([]byte{}, n...), c...), t...)
+	token := pasetoHeader + base64.RawURLEncoding.EncodeToString(body)
+	if len(f) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(f)
+	}
+	return token, nil
+}
+
+// pasetoSplit returns the raw body and footer of a v4.local token.
+func pasetoSplit(token string) (body, f []byte, err error) {
+	if !strings.HasPrefix(token, pasetoHeader) {
+		return nil, nil, ErrInvalidToken
+	}
+	parts := strings.Split(strings.TrimPrefix(token, pasetoHeader), ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	//strict so a token has a single valid encoding
+	body, err = base64.RawURLEncoding.Strict().DecodeString(parts[0])
+	if err != nil || len(body) < 64 {
+		return nil, nil, ErrInvalidToken
+	}
+	if len(parts) == 2 {
+		if f, err = base64.RawURLEncoding.Strict().DecodeString(parts[1]); err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return body, f, nil
+}
+
+// pasetoDecrypt checks the tag of a v4.local body before decrypting it.
+func pasetoDecrypt(key, body, f, i []byte) ([]byte, error) {
+	n, c, t := body[:32], body[32:len(body)-32], body[len(body)-32:]
+	ek, n2, ak, err := pasetoSplitKey(key, n)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := pasetoMAC(ak, n, c, f, i)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(t, expected) != 1 {
+		return nil, ErrInvalidToken
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	m := make([]byte, len(c))
+	cipher.XORKeyStream(m, c)
+	return m, nil
+}
+
+// pasetoSplitKey derives the encryption key, the cipher nonce and the authentication key from the nonce n.
+func pasetoSplitKey(key, n []byte) (ek, n2, ak []byte, err error) {
+	h, err := blake2b.New(56, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to derive encryption key: %v", err)
+	}
+	h.Write([]byte("paseto-encryption-key"))
+	h.Write(n)
+	tmp := h.Sum(nil)
+
+	h, err = blake2b.New(32, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to derive authentication key: %v", err)
+	}
+	h.Write([]byte("paseto-auth-key-for-aead"))
+	h.Write(n)
+
+	return tmp[:32], tmp[32:], h.Sum(nil), nil
+}
+
+func pasetoMAC(ak, n, c, f, i []byte) ([]byte, error) {
+	h, err := blake2b.New(32, ak)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mac: %v", err)
+	}
+	h.Write(pae([]byte(pasetoHeader), n, c, f, i))
+	return h.Sum(nil), nil
+}
+
+// pae is the PASETO pre-authentication encoding of pieces.
+func pae(pieces ...[]byte) []byte {
+	var b bytes.Buffer
+	le64 := func(n int) {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(n)&(1<<63-1))
+		b.Write(buf[:])
+	}
+	le64(len(pieces))
+	for _, p := range pieces {
+		le64(len(p))
+		b.Write(p)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,259 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pasetoVector struct {
+	name      string
+	key       string
+	nonce     string
+	token     string
+	payload   string
+	footer    string
+	assertion string
+}
+
+// pasetoVectorKey is the symmetric key shared by every v4.local test vector.
+const pasetoVectorKey = "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f"
+
+// pasetoVectors are the v4.local encryption vectors of https://github.com/paseto-standard/test-vectors.
+var pasetoVectors = []pasetoVector{
+	{
+		name:      "4-E-1",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "0000000000000000000000000000000000000000000000000000000000000000",
+		token:     "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		payload:   "{\"data\":\"this is a secret message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "",
+		assertion: "",
+	},
+	{
+		name:      "4-E-2",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "0000000000000000000000000000000000000000000000000000000000000000",
+		token:     "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvS2csCgglvpk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XIemu9chy3WVKvRBfg6t8wwYHK0ArLxxfZP73W_vfwt5A",
+		payload:   "{\"data\":\"this is a hidden message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "",
+		assertion: "",
+	},
+	{
+		name:      "4-E-3",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6-tyebyWG6Ov7kKvBdkrrAJ837lKP3iDag2hzUPHuMKA",
+		payload:   "{\"data\":\"this is a secret message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "",
+		assertion: "",
+	},
+	{
+		name:      "4-E-4",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WiA8rd3wgFSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t4gt6TiLm55vIH8c_lGxxZpE3AWlH4WTR0v45nsWoU3gQ",
+		payload:   "{\"data\":\"this is a hidden message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "",
+		assertion: "",
+	},
+	{
+		name:      "4-E-5",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t4x-RMNXtQNbz7FvFZ_G-lFpk5RG3EOrwDL6CgDqcerSQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		payload:   "{\"data\":\"this is a secret message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "{\"kid\":\"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN\"}",
+		assertion: "",
+	},
+	{
+		name:      "4-E-6",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WiA8rd3wgFSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6pWSA5HX2wjb3P-xLQg5K5feUCX4P2fpVK3ZLWFbMSxQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		payload:   "{\"data\":\"this is a hidden message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "{\"kid\":\"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN\"}",
+		assertion: "",
+	},
+	{
+		name:      "4-E-7",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t40KCCWLA7GYL9KFHzKlwY9_RnIfRrMQpueydLEAZGGcA.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		payload:   "{\"data\":\"this is a secret message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "{\"kid\":\"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN\"}",
+		assertion: "{\"test-vector\":\"4-E-7\"}",
+	},
+	{
+		name:      "4-E-8",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WiA8rd3wgFSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t5uvqQbMGlLLNYBc7A6_x7oqnpUK5WLvj24eE4DVPDZjw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		payload:   "{\"data\":\"this is a hidden message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "{\"kid\":\"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN\"}",
+		assertion: "{\"test-vector\":\"4-E-8\"}",
+	},
+	{
+		name:      "4-E-9",
+		key:       "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f",
+		nonce:     "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WiA8rd3wgFSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6tybdlmnMwcDMw0YxA_gFSE_IUWl78aMtOepFYSWYfQA.YXJiaXRyYXJ5LXN0cmluZy10aGF0LWlzbid0LWpzb24",
+		payload:   "{\"data\":\"this is a hidden message\",\"exp\":\"2022-01-01T00:00:00+00:00\"}",
+		footer:    "arbitrary-string-that-isn't-json",
+		assertion: "{\"test-vector\":\"4-E-9\"}",
+	},
+}
+
+// pasetoFailVectors must be rejected by a v4.local implementation.
+var pasetoFailVectors = []pasetoVector{
+	{
+		name:      "4-F-1",
+		token:     "v4.local.vngXfCISbnKgiP6VWGuOSlYrFYU300fy9ijW33rznDYgxHNPwWluAY2Bgb0z54CUs6aYYkIJ-bOOOmJHPuX_34Agt_IPlNdGDpRdGNnBz2MpWJvB3cttheEc1uyCEYltj7wBQQYX.YXJiaXRyYXJ5LXN0cmluZy10aGF0LWlzbid0LWpzb24",
+		assertion: "{\"test-vector\":\"4-F-1\"}",
+	},
+	{
+		name:      "4-F-2",
+		token:     "v4.public.eyJpbnZhbGlkIjoidGhpcyBzaG91bGQgbmV2ZXIgZGVjb2RlIn22Sp4gjCaUw0c7EH84ZSm_jN_Qr41MrgLNu5LIBCzUr1pn3Z-Wukg9h3ceplWigpoHaTLcwxj0NsI1vjTh67YB.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		assertion: "{\"test-vector\":\"4-F-2\"}",
+	},
+	{
+		name:      "4-F-3",
+		token:     "v3.local.23e_2PiqpQBPvRFKzB0zHhjmxK3sKo2grFZRRLM-U7L0a8uHxuF9RlVz3Ic6WmdUUWTxCaYycwWV1yM8gKbZB2JhygDMKvHQ7eBf8GtF0r3K0Q_gF1PXOxcOgztak1eD1dPe9rLVMSgR0nHJXeIGYVuVrVoLWQ.YXJiaXRyYXJ5LXN0cmluZy10aGF0LWlzbid0LWpzb24",
+		assertion: "{\"test-vector\":\"4-F-3\"}",
+	},
+	{
+		name:      "4-F-4",
+		token:     "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQh",
+		assertion: "",
+	},
+	{
+		name:      "4-F-5",
+		token:     "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t4x-RMNXtQNbz7FvFZ_G-lFpk5RG3EOrwDL6CgDqcerSQ==.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		assertion: "",
+	},
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPasetoVectors(t *testing.T) {
+	key := mustHex(t, pasetoVectorKey)
+	for _, v := range pasetoVectors {
+		t.Run(v.name, func(t *testing.T) {
+			token, err := pasetoEncrypt(key, mustHex(t, v.nonce), []byte(v.payload), []byte(v.footer), []byte(v.assertion))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != v.token {
+				t.Fatalf("encrypt = %s, want %s", token, v.token)
+			}
+
+			body, f, err := pasetoSplit(v.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(f) != v.footer {
+				t.Fatalf("footer = %q, want %q", f, v.footer)
+			}
+			m, err := pasetoDecrypt(key, body, f, []byte(v.assertion))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(m) != v.payload {
+				t.Fatalf("decrypt = %s, want %s", m, v.payload)
+			}
+		})
+	}
+}
+
+func TestPasetoFailVectors(t *testing.T) {
+	key := mustHex(t, pasetoVectorKey)
+	for _, v := range pasetoFailVectors {
+		t.Run(v.name, func(t *testing.T) {
+			body, f, err := pasetoSplit(v.token)
+			if err != nil {
+				return
+			}
+			if _, err = pasetoDecrypt(key, body, f, []byte(v.assertion)); err == nil {
+				t.Fatal("expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func TestPasetoWrongAssertion(t *testing.T) {
+	key := mustHex(t, pasetoVectorKey)
+	for _, v := range pasetoVectors {
+		if v.assertion == "" {
+			continue
+		}
+		body, f, err := pasetoSplit(v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = pasetoDecrypt(key, body, f, nil); err != ErrInvalidToken {
+			t.Fatalf("%s: err = %v, want %v", v.name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func testKeyRing(t *testing.T, ids ...string) KeyRing {
+	t.Helper()
+	var keys []string
+	for _, id := range ids {
+		keys = append(keys, id+":"+strings.Repeat(id[:1], 32))
+	}
+	ring, err := ParseKeyRing(strings.Join(keys, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestPasetoClaims(t *testing.T) {
+	p := NewPaseto(testKeyRing(t, "a"), time.Hour)
+	in := Claims{UserID: 42, SessionID: 7, Scopes: []string{ScopeRead, ScopeWrite}}
+	token, err := p.EncodeClaims(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := p.DecodeClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.UserID != in.UserID || out.SessionID != in.SessionID || !out.HasScope(ScopeWrite) {
+		t.Fatalf("claims = %+v, want %+v", out, in)
+	}
+
+	//flip one bit of the ciphertext
+	body, f, err := pasetoSplit(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body[40] ^= 1
+	tampered := pasetoHeader + base64.RawURLEncoding.EncodeToString(body) + "." + base64.RawURLEncoding.EncodeToString(f)
+	if _, err = p.DecodeClaims(tampered); err != ErrInvalidToken {
+		t.Fatalf("tampered: err = %v, want %v", err, ErrInvalidToken)
+	}
+
+	expired, err := p.EncodeClaims(Claims{UserID: 42, IssuedAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.DecodeClaims(expired); err != ErrTokenExpired {
+		t.Fatalf("expired: err = %v, want %v", err, ErrTokenExpired)
+	}
+
+	other := NewPaseto(testKeyRing(t, "b"), time.Hour)
+	if _, err = other.DecodeClaims(token); err != ErrUnknownKeyID {
+		t.Fatalf("unknown kid: err = %v, want %v", err, ErrUnknownKeyID)
+	}
+}
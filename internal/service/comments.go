@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 type ToggleCommentLikeOutput struct {
@@ -28,7 +30,8 @@ type Comment struct {
 }
 
 var (
-	ErrCommentNotFound = errors.New("comment not found")
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrNotCommentAuthor = errors.New("comment belongs to another user")
 )
 
 //CreateComment and update post comment Count
@@ -38,12 +41,29 @@ func (s *Service) CreateComment(ctx context.Context, content string, postId int6
 	if !ok {
 		return comment, ErrUnAuthorized
 	}
+	if err := s.ensureVerified(ctx, uid); err != nil {
+		return comment, err
+	}
 	//Begin transasction
 	tx, err := s.Db.Begin(ctx)
 	if err != nil {
 		return comment, fmt.Errorf("can not start the creating comment transcation, error: %v", err)
 	}
 	defer tx.Rollback(ctx)
+	blocked, err := postBlocked(ctx, tx, uid, postId)
+	if err != nil {
+		return comment, err
+	}
+	if blocked {
+		return comment, ErrPostNotFound
+	}
+	visible, err := postVisible(ctx, tx, uid, postId)
+	if err != nil {
+		return comment, err
+	}
+	if !visible {
+		return comment, ErrPrivateAccount
+	}
 	//query to create comment and get the comment id,created_at,updated_at
 	query := "INSERT INTO comments (user_id, post_id, content) VALUES ($1, $2, $3) RETURNING id, created_at"
 
@@ -99,6 +119,23 @@ func (s *Service) CommentCreated(c Comment) {
 func (s *Service) GetPostComments(ctx context.Context, postId int64, last int, before string) ([]Comment, error) {
 	var comments []Comment
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
+	visible, err := postVisible(ctx, s.Db, uid, postId)
+	if err != nil {
+		return comments, err
+	}
+	if !visible {
+		return comments, ErrPrivateAccount
+	}
+	if auth {
+		//the thread goes with the post, which is hidden when the viewer and its author blocked each other
+		blocked, err := postBlocked(ctx, s.Db, uid, postId)
+		if err != nil {
+			return comments, err
+		}
+		if blocked {
+			return comments, ErrPostNotFound
+		}
+	}
 
 	query, args, err := buildQuery(`SELECT comments.id, comments.user_id, comments.post_id, comments.content, comments.likes_count,comments.created_at
 	,users.username As username, users.avatar As avatar_url
@@ -112,6 +149,13 @@ func (s *Service) GetPostComments(ctx context.Context, postId int64, last int, b
 	LEFT JOIN comment_likes ON comment_likes.comment_id = comments.id AND comment_likes.user_id = @uid
 	{{end}}
 	WHERE comments.post_id = @postId
+	{{if .Auth}}
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = comments.user_id) OR (blocks.blocker_id = comments.user_id AND blocks.blocked_id = @uid))
+	AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = comments.user_id
+		AND (mutes.expires_at IS NULL OR mutes.expires_at > now()))
+	AND (comments.user_id = @uid OR NOT EXISTS (SELECT 1 FROM muted_words WHERE muted_words.user_id = @uid
+		AND (muted_words.expires_at IS NULL OR muted_words.expires_at > now()) AND strpos(lower(comments.content), muted_words.phrase) > 0))
+	{{end}}
 	{{if .before}}
 	AND comments.id < @before
 	{{end}}
@@ -151,10 +195,7 @@ func (s *Service) GetPostComments(ctx context.Context, postId int64, last int, b
 		if err = rows.Scan(dest...); err != nil {
 			return comments, fmt.Errorf("can not scan comment, error: %v", err)
 		}
-		if avatar.Valid {
-			url := s.Origin + "/img/avatars" + avatar.String
-			u.AvatarUrl = &url
-		}
+		u.Avatar = s.avatarURLs(avatar)
 		comment.User = &u
 		comments = append(comments, comment)
 
@@ -180,8 +221,39 @@ func (s *Service) ToggleCommentLike(ctx context.Context, commentId int64) (Toggl
 	}
 	defer tx.Rollback(ctx)
 
+	//comments of posts the user can not see can not be liked either
+	var postID, authorID int64
+	query := "SELECT post_id, user_id FROM comments WHERE id = $1"
+	err = tx.QueryRow(ctx, query, commentId).Scan(&postID, &authorID)
+	if err == pgx.ErrNoRows {
+		return output, ErrCommentNotFound
+	}
+	if err != nil {
+		return output, fmt.Errorf("can not query the comment, error: %v", err)
+	}
+	blocked, err := blockedBetween(ctx, tx, uid, authorID)
+	if err != nil {
+		return output, err
+	}
+	if !blocked {
+		blocked, err = postBlocked(ctx, tx, uid, postID)
+		if err != nil {
+			return output, err
+		}
+	}
+	if blocked {
+		return output, ErrCommentNotFound
+	}
+	visible, err := postVisible(ctx, tx, uid, postID)
+	if err != nil {
+		return output, err
+	}
+	if !visible {
+		return output, ErrPrivateAccount
+	}
+
 	//query to check if the user has liked the comment
-	query := "Select Exists (SELECT 1 FROM comment_likes WHERE comment_id = $1 AND user_id = $2)"
+	query = "Select Exists (SELECT 1 FROM comment_likes WHERE comment_id = $1 AND user_id = $2)"
 
 	if err := tx.QueryRow(ctx, query, commentId, uid).Scan(&output.Liked); err != nil {
 		return output, fmt.Errorf("can not check if the user has liked the comment, error: %v", err)
@@ -226,3 +298,62 @@ func (s *Service) ToggleCommentLike(ctx context.Context, commentId int64) (Toggl
 
 	return output, nil
 }
+
+// DeleteComment removes a comment of the auth user, or any comment on a post of the auth user,
+// fixing the post comments count and the comment notifications.
+func (s *Service) DeleteComment(ctx context.Context, commentID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the delete comment transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var authorID, postID, postAuthorID int64
+	query := `SELECT comments.user_id, comments.post_id, posts.user_id FROM comments
+	INNER JOIN posts ON posts.id = comments.post_id
+	WHERE comments.id = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, query, commentID).Scan(&authorID, &postID, &postAuthorID)
+	if err == pgx.ErrNoRows {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("can not query the comment, error: %v", err)
+	}
+	if uid != authorID && uid != postAuthorID {
+		return ErrNotCommentAuthor
+	}
+
+	query = "DELETE FROM comment_likes WHERE comment_id = $1"
+	if _, err = tx.Exec(ctx, query, commentID); err != nil {
+		return fmt.Errorf("can not delete comment likes, error: %v", err)
+	}
+	query = "DELETE FROM comments WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, commentID); err != nil {
+		return fmt.Errorf("can not delete comment, error: %v", err)
+	}
+	query = "UPDATE posts SET comments_count = comments_count - 1 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, postID); err != nil {
+		return fmt.Errorf("can not update post comments count, error: %v", err)
+	}
+
+	//the author stays in the notifications while they have other comments on the post
+	query = `UPDATE notifications SET actor_ids = array_remove(actor_ids, $2::INT)
+	WHERE post_id = $1 AND type IN ('comment', 'comment_mention') AND $2::INT = any(actor_ids)
+	AND NOT EXISTS (SELECT 1 FROM comments WHERE post_id = $1 AND user_id = $2)`
+	if _, err = tx.Exec(ctx, query, postID, authorID); err != nil {
+		return fmt.Errorf("can not remove comment author from notifications, error: %v", err)
+	}
+	query = "DELETE FROM notifications WHERE post_id = $1 AND type IN ('comment', 'comment_mention') AND array_length(actor_ids, 1) IS NULL"
+	if _, err = tx.Exec(ctx, query, postID); err != nil {
+		return fmt.Errorf("can not delete empty notifications, error: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the delete comment transcation, error: %v", err)
+	}
+	return nil
+}
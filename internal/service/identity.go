@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const OIDCStateLifetime = time.Minute * 10
+
+var (
+	ErrProviderNotFound      = errors.New("sign in provider not found")
+	ErrInvalidOIDCState      = errors.New("invalid or expired sign in state")
+	ErrOIDCEmailNotVerified  = errors.New("provider did not verify the email address")
+	ErrIdentityTaken         = errors.New("identity already linked to another user")
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrProviderAlreadyLinked = errors.New("an account of this provider is already linked")
+	ErrOIDCLinkRequired      = errors.New("an account with this email exists, log in and link the provider with POST /api/users/me/identities/{provider}")
+)
+
+var nonAlphanumeric = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// Identity model, an external account linked to a user
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCAuthRequest is where to send the browser to sign in. The browser keeps State
+// and Nonce, in a cookie, to prove on callback that it started the sign in.
+type OIDCAuthRequest struct {
+	URL   string
+	State string
+	Nonce string
+}
+
+type OIDCCallbackOutput struct {
+	Linked bool         `json:"linked"`
+	Login  *LoginOutput `json:"login,omitempty"`
+}
+
+// OIDCAuthURL starts a sign in with the provider. When the request is authenticated
+// the callback links the identity to the auth user instead of logging in.
+func (s *Service) OIDCAuthURL(ctx context.Context, provider string) (OIDCAuthRequest, error) {
+	var out OIDCAuthRequest
+	p, ok := s.OIDCProviders[provider]
+	if !ok {
+		return out, ErrProviderNotFound
+	}
+	var linkUserID *int64
+	if uid, ok := ctx.Value(KeyAuthUserID).(int64); ok {
+		linkUserID = &uid
+	}
+
+	state, err := gonanoid.New(32)
+	if err != nil {
+		return out, fmt.Errorf("could not generate oidc state: %v", err)
+	}
+	nonce, err := gonanoid.New(32)
+	if err != nil {
+		return out, fmt.Errorf("could not generate oidc nonce: %v", err)
+	}
+
+	query := "INSERT INTO oidc_states (state_hash, provider, nonce, user_id, expires_at) VALUES ($1, $2, $3, $4, now() + $5::INTERVAL)"
+	if _, err = s.Db.Exec(ctx, query, hashSecret(state), provider, nonce, linkUserID, OIDCStateLifetime); err != nil {
+		return out, fmt.Errorf("could not insert oidc state: %v", err)
+	}
+
+	out.URL = p.AuthCodeURL(state, nonce)
+	out.State = state
+	out.Nonce = nonce
+	return out, nil
+}
+
+// OIDCCallback finishes a sign in started by OIDCAuthURL, nonce is the one kept by the browser.
+// Identities are matched by provider subject first, then by verified email, else a new account is created.
+// An account whose email was never verified is not linked, whoever registered it could still log in with its password.
+func (s *Service) OIDCCallback(ctx context.Context, provider, state, nonce, code string) (OIDCCallbackOutput, error) {
+	var out OIDCCallbackOutput
+	p, ok := s.OIDCProviders[provider]
+	if !ok {
+		return out, ErrProviderNotFound
+	}
+
+	var storedNonce string
+	var linkUserID *int64
+	query := "UPDATE oidc_states SET used_at = now() WHERE state_hash = $1 AND provider = $2 AND used_at IS NULL AND expires_at > now() RETURNING nonce, user_id"
+	err := s.Db.QueryRow(ctx, query, hashSecret(state), provider).Scan(&storedNonce, &linkUserID)
+	if err == pgx.ErrNoRows {
+		return out, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return out, fmt.Errorf("could not consume oidc state: %v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(storedNonce)) != 1 {
+		return out, ErrInvalidOIDCState
+	}
+
+	idToken, err := p.Exchange(ctx, code, nonce)
+	if err != nil {
+		return out, err
+	}
+
+	if linkUserID != nil {
+		if err = s.linkIdentity(ctx, *linkUserID, provider, idToken.Subject, idToken.Email); err != nil {
+			return out, err
+		}
+		out.Linked = true
+		return out, nil
+	}
+
+	var uid int64
+	query = "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2"
+	err = s.Db.QueryRow(ctx, query, provider, idToken.Subject).Scan(&uid)
+	if err != nil && err != pgx.ErrNoRows {
+		return out, fmt.Errorf("could not query identity: %v", err)
+	}
+	if err == pgx.ErrNoRows {
+		if !idToken.EmailVerified || idToken.Email == "" {
+			return out, ErrOIDCEmailNotVerified
+		}
+		var verified bool
+		query = "SELECT id, verified_at IS NOT NULL FROM users WHERE lower(email) = lower($1) ORDER BY verified_at IS NULL LIMIT 1"
+		err = s.Db.QueryRow(ctx, query, idToken.Email).Scan(&uid, &verified)
+		if err == nil && !verified {
+			return out, ErrOIDCLinkRequired
+		}
+		if err == pgx.ErrNoRows {
+			uid, err = s.createOIDCUser(ctx, idToken.Email)
+		}
+		if err != nil {
+			return out, fmt.Errorf("could not find or create user for identity: %v", err)
+		}
+		if err = s.linkIdentity(ctx, uid, provider, idToken.Subject, idToken.Email); err != nil {
+			return out, err
+		}
+	}
+
+	lo, err := s.completeLogin(ctx, uid)
+	if err != nil {
+		return out, err
+	}
+	out.Login = &lo
+	return out, nil
+}
+
+func (s *Service) linkIdentity(ctx context.Context, uid int64, provider, subject, email string) error {
+	query := "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) ON CONFLICT (provider, subject) DO NOTHING"
+	commandTag, err := s.Db.Exec(ctx, query, uid, provider, subject, email)
+	if isUnquieViolation(err) {
+		return ErrProviderAlreadyLinked
+	}
+	if err != nil {
+		return fmt.Errorf("could not link identity: %v", err)
+	}
+	if commandTag.RowsAffected() == 1 {
+		return nil
+	}
+	var owner int64
+	query = "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2"
+	if err = s.Db.QueryRow(ctx, query, provider, subject).Scan(&owner); err != nil {
+		return fmt.Errorf("could not query identity owner: %v", err)
+	}
+	if owner != uid {
+		return ErrIdentityTaken
+	}
+	return nil
+}
+
+// createOIDCUser creates an account named after the email local part, adding a suffix while the name is taken.
+func (s *Service) createOIDCUser(ctx context.Context, email string) (int64, error) {
+	base := nonAlphanumeric.ReplaceAllString(strings.SplitN(email, "@", 2)[0], "")
+	if len(base) < 2 {
+		base = "user"
+	}
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	username := base
+	for i := 0; i < 5; i++ {
+		reserved, err := s.usernameReserved(ctx, username)
+		if err != nil {
+			return 0, err
+		}
+		if !reserved {
+			var uid int64
+			query := "INSERT INTO users (email, username, verified_at) VALUES ($1, $2, now()) ON CONFLICT (username) DO NOTHING RETURNING id"
+			err = s.Db.QueryRow(ctx, query, email, username).Scan(&uid)
+			if err == nil {
+				log.Printf("created user %s from sign in provider", username)
+				return uid, nil
+			}
+			if err != pgx.ErrNoRows {
+				return 0, err
+			}
+		}
+		suffix, err := gonanoid.Generate("0123456789", 4)
+		if err != nil {
+			return 0, err
+		}
+		username = base + suffix
+	}
+	return 0, ErrUsernameTaken
+}
+
+// Identities lists the external accounts linked to the auth user.
+func (s *Service) Identities(ctx context.Context) ([]Identity, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	query := "SELECT provider, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY provider"
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query identities: %v", err)
+	}
+	defer rows.Close()
+
+	ii := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err = rows.Scan(&i.Provider, &i.Email, &i.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan identity: %v", err)
+		}
+		ii = append(ii, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate identity rows: %v", err)
+	}
+	return ii, nil
+}
+
+// UnlinkIdentity removes the auth user's identity of the given provider,
+// the account stays reachable through email login.
+func (s *Service) UnlinkIdentity(ctx context.Context, provider string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "DELETE FROM user_identities WHERE user_id = $1 AND provider = $2"
+	commandTag, err := s.Db.Exec(ctx, query, uid, provider)
+	if err != nil {
+		return fmt.Errorf("could not unlink identity: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
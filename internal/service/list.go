@@ -0,0 +1,476 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrListNotFound       = errors.New("list not found")
+	ErrListNameTaken      = errors.New("list name already taken")
+	ErrListMemberNotFound = errors.New("list member not found")
+	ErrListOwner          = errors.New("only the list owner can do this")
+)
+
+// List model, a curated set of accounts with its own timeline
+type List struct {
+	ID               int64     `json:"id"`
+	Name             string    `json:"name"`
+	Description      *string   `json:"description"`
+	IsPrivate        bool      `json:"is_private"`
+	MembersCount     int       `json:"members_count"`
+	SubscribersCount int       `json:"subscribers_count"`
+	Owner            *User     `json:"owner"`
+	IsMine           bool      `json:"is_mine"`
+	Subscribed       bool      `json:"subscribed"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type ToggleListSubscriptionOutput struct {
+	Subscribed       bool `json:"subscribed"`
+	SubscribersCount int  `json:"subscribers_count"`
+}
+
+// CreateList creates a list owned by the auth user.
+func (s *Service) CreateList(ctx context.Context, name string, description *string, private bool) (List, error) {
+	var l List
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return l, ErrUnAuthorized
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return l, ErrValidations
+	}
+	if description != nil {
+		*description = strings.TrimSpace(*description)
+		if *description == "" {
+			description = nil
+		}
+	}
+
+	query := "INSERT INTO lists (user_id, name, description, is_private) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	err := s.Db.QueryRow(ctx, query, uid, name, description, private).Scan(&l.ID, &l.CreatedAt)
+	if isUnquieViolation(err) {
+		return l, ErrListNameTaken
+	}
+	if err != nil {
+		return l, fmt.Errorf("could not insert list: %v", err)
+	}
+	l.Name = name
+	l.Description = description
+	l.IsPrivate = private
+	l.IsMine = true
+	return l, nil
+}
+
+// DeleteList deletes one of the auth user's lists with its members and subscriptions.
+func (s *Service) DeleteList(ctx context.Context, listID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the delete list transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = ownList(ctx, tx, uid, listID); err != nil {
+		return err
+	}
+	steps := []struct {
+		query string
+		what  string
+	}{
+		{"DELETE FROM notifications WHERE list_id = $1", "delete list notifications"},
+		{"DELETE FROM list_members WHERE list_id = $1", "delete list members"},
+		{"DELETE FROM list_subscriptions WHERE list_id = $1", "delete list subscriptions"},
+		{"DELETE FROM lists WHERE id = $1", "delete list"},
+	}
+	for _, step := range steps {
+		if _, err = tx.Exec(ctx, step.query, listID); err != nil {
+			return fmt.Errorf("could not %s: %v", step.what, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the delete list transcation, error: %v", err)
+	}
+	return nil
+}
+
+// List returns a list by id, private lists are only visible to their owner.
+func (s *Service) List(ctx context.Context, listID int64) (List, error) {
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	ll, err := s.queryLists(ctx, "lists.id = @listID", map[string]interface{}{"listID": listID, "uid": uid})
+	if err != nil {
+		return List{}, err
+	}
+	if len(ll) == 0 {
+		return List{}, ErrListNotFound
+	}
+	return ll[0], nil
+}
+
+// ListsByUser returns the lists owned by the given user, private ones only to the user.
+func (s *Service) ListsByUser(ctx context.Context, username string) ([]List, error) {
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	return s.queryLists(ctx, "owners.username = @username", map[string]interface{}{"username": username, "uid": uid})
+}
+
+// SubscribedLists returns the lists the auth user subscribed to.
+func (s *Service) SubscribedLists(ctx context.Context) ([]List, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	return s.queryLists(ctx, "list_subscriptions.user_id IS NOT NULL", map[string]interface{}{"uid": uid})
+}
+
+func (s *Service) queryLists(ctx context.Context, where string, data map[string]interface{}) ([]List, error) {
+	data["where"] = where
+	query, args, err := buildQuery(`SELECT lists.id, lists.name, lists.description, lists.is_private
+	,lists.members_count, lists.subscribers_count, lists.created_at
+	,owners.username, owners.avatar
+	,lists.user_id = @uid AS mine
+	,list_subscriptions.user_id IS NOT NULL AS subscribed
+	FROM lists
+	INNER JOIN users AS owners ON owners.id = lists.user_id
+	LEFT JOIN list_subscriptions ON list_subscriptions.list_id = lists.id AND list_subscriptions.user_id = @uid
+	WHERE (NOT lists.is_private OR lists.user_id = @uid)
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = lists.user_id) OR (blocks.blocker_id = lists.user_id AND blocks.blocked_id = @uid))
+	AND {{.where}}
+	ORDER BY lists.id DESC`, data)
+	if err != nil {
+		return nil, fmt.Errorf("can not build lists query, error: %v", err)
+	}
+	rows, err := s.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query lists: %v", err)
+	}
+	defer rows.Close()
+
+	ll := []List{}
+	for rows.Next() {
+		var l List
+		var owner User
+		var avatar sql.NullString
+		dest := []interface{}{&l.ID, &l.Name, &l.Description, &l.IsPrivate, &l.MembersCount, &l.SubscribersCount, &l.CreatedAt, &owner.Username, &avatar, &l.IsMine, &l.Subscribed}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan list: %v", err)
+		}
+		owner.Avatar = s.avatarURLs(avatar)
+		l.Owner = &owner
+		ll = append(ll, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate list rows: %v", err)
+	}
+	return ll, nil
+}
+
+// AddListMember adds the user to one of the auth user's lists. When notify is set and
+// the list is public the added user gets a notification.
+func (s *Service) AddListMember(ctx context.Context, listID int64, username string, notify bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the add list member transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = ownList(ctx, tx, uid, listID); err != nil {
+		return err
+	}
+	var memberID int64
+	query := "SELECT id FROM users WHERE username = $1"
+	err = tx.QueryRow(ctx, query, username).Scan(&memberID)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query id from given username, error %v", err)
+	}
+	blocked, err := blockedBetween(ctx, tx, uid, memberID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserBlocked
+	}
+
+	query = "INSERT INTO list_members (list_id, user_id) VALUES ($1, $2) ON CONFLICT (list_id, user_id) DO NOTHING"
+	commandTag, err := tx.Exec(ctx, query, listID, memberID)
+	if err != nil {
+		return fmt.Errorf("could not insert list member: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return nil
+	}
+	var private bool
+	query = "UPDATE lists SET members_count = members_count + 1 WHERE id = $1 RETURNING is_private"
+	if err = tx.QueryRow(ctx, query, listID).Scan(&private); err != nil {
+		return fmt.Errorf("could not update list members count: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the add list member transcation, error: %v", err)
+	}
+	if notify && !private && memberID != uid {
+		go s.NotifyListMember(uid, memberID, listID)
+	}
+	return nil
+}
+
+// RemoveListMember removes the user from one of the auth user's lists.
+func (s *Service) RemoveListMember(ctx context.Context, listID int64, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the remove list member transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = ownList(ctx, tx, uid, listID); err != nil {
+		return err
+	}
+	query := "DELETE FROM list_members WHERE list_id = $1 AND user_id = (SELECT id FROM users WHERE username = $2)"
+	commandTag, err := tx.Exec(ctx, query, listID, username)
+	if err != nil {
+		return fmt.Errorf("could not delete list member: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrListMemberNotFound
+	}
+	query = "UPDATE lists SET members_count = members_count - 1 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, listID); err != nil {
+		return fmt.Errorf("could not update list members count: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the remove list member transcation, error: %v", err)
+	}
+	return nil
+}
+
+// ListMembers returns the members of a list ordered by username.
+func (s *Service) ListMembers(ctx context.Context, listID int64, first int, after string) ([]User, error) {
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	first = normalizePageSize(first)
+	after = strings.TrimSpace(after)
+	if err := listVisible(ctx, s.Db, uid, listID); err != nil {
+		return nil, err
+	}
+	query, args, err := buildQuery(`SELECT users.username, users.avatar FROM list_members
+	INNER JOIN users ON users.id = list_members.user_id
+	WHERE list_members.list_id = @listID
+	{{if .after}} AND users.username > @after {{end}}
+	ORDER BY users.username ASC
+	LIMIT @first`, map[string]interface{}{
+		"listID": listID,
+		"after":  after,
+		"first":  first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not build list members query, error: %v", err)
+	}
+	rows, err := s.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query list members: %v", err)
+	}
+	defer rows.Close()
+
+	uu := make([]User, 0, first)
+	for rows.Next() {
+		var u User
+		var avatar sql.NullString
+		if err = rows.Scan(&u.Username, &avatar); err != nil {
+			return nil, fmt.Errorf("could not scan list member: %v", err)
+		}
+		u.Avatar = s.avatarURLs(avatar)
+		uu = append(uu, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate list member rows: %v", err)
+	}
+	return uu, nil
+}
+
+// ToggleListSubscription subscribes the auth user to a list or cancels the subscription.
+func (s *Service) ToggleListSubscription(ctx context.Context, listID int64) (ToggleListSubscriptionOutput, error) {
+	var out ToggleListSubscriptionOutput
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return out, fmt.Errorf("can not start the list subscription transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = listVisible(ctx, tx, uid, listID); err != nil {
+		return out, err
+	}
+	query := "DELETE FROM list_subscriptions WHERE list_id = $1 AND user_id = $2"
+	commandTag, err := tx.Exec(ctx, query, listID, uid)
+	if err != nil {
+		return out, fmt.Errorf("could not delete list subscription: %v", err)
+	}
+	query = "UPDATE lists SET subscribers_count = subscribers_count - 1 WHERE id = $1 RETURNING subscribers_count"
+	if commandTag.RowsAffected() == 0 {
+		query = "INSERT INTO list_subscriptions (list_id, user_id) VALUES ($1, $2)"
+		if _, err = tx.Exec(ctx, query, listID, uid); err != nil {
+			return out, fmt.Errorf("could not insert list subscription: %v", err)
+		}
+		out.Subscribed = true
+		query = "UPDATE lists SET subscribers_count = subscribers_count + 1 WHERE id = $1 RETURNING subscribers_count"
+	}
+	if err = tx.QueryRow(ctx, query, listID).Scan(&out.SubscribersCount); err != nil {
+		return out, fmt.Errorf("could not update list subscribers count: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return out, fmt.Errorf("can not commit the list subscription transcation, error: %v", err)
+	}
+	return out, nil
+}
+
+// ListTimeline returns the posts of the list members, newest first, in the shape of RetrieveTimelineItems.
+// Items are identified by post id since list timelines are not materialized.
+func (s *Service) ListTimeline(ctx context.Context, listID int64, last int, before string) ([]TimelineItem, error) {
+	var items []TimelineItem
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return items, ErrUnAuthorized
+	}
+	if err := listVisible(ctx, s.Db, uid, listID); err != nil {
+		return items, err
+	}
+	query, args, err := buildQuery(`SELECT posts.id,content, created_at,updated_at,likes_count,spoiler,nsfw
+	,users.username As username
+	,users.avatar As avatar_url
+	,posts.user_id = @uid As mine
+	,likes.user_id is not null As liked
+	FROM list_members
+	Inner join posts on posts.user_id = list_members.user_id
+	Inner join users on users.id = posts.user_id
+	LEFT JOIN likes ON likes.post_id = posts.id AND likes.user_id = @uid
+	WHERE list_members.list_id = @listID
+	AND (NOT users.is_private OR users.id = @uid
+		OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @uid AND follows.following_id = users.id))
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = posts.user_id) OR (blocks.blocker_id = posts.user_id AND blocks.blocked_id = @uid))
+	AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = posts.user_id
+		AND (mutes.expires_at IS NULL OR mutes.expires_at > now()))
+	AND (posts.user_id = @uid OR NOT EXISTS (SELECT 1 FROM muted_words WHERE muted_words.user_id = @uid
+		AND (muted_words.expires_at IS NULL OR muted_words.expires_at > now()) AND strpos(lower(posts.content), muted_words.phrase) > 0))
+	{{if .before}}
+	AND posts.id < @before
+	{{end}}
+	order by posts.id desc
+	{{if .last}}
+	limit @last
+	{{end}}
+	`, map[string]interface{}{
+		"listID": listID,
+		"last":   last,
+		"before": before,
+		"uid":    uid,
+	})
+	if err != nil {
+		return items, fmt.Errorf("can not build list timeline query, error: %v", err)
+	}
+	rows, err := s.Db.Query(ctx, query, args...)
+	if err != nil {
+		return items, fmt.Errorf("can not get list timeline posts, error: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item TimelineItem
+		var u User
+		var avatar sql.NullString
+		p := &item.Post
+		if err = rows.Scan(&p.ID, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &u.Username, &avatar, &p.IsMe, &p.Liked); err != nil {
+			return items, fmt.Errorf("can not scan post, error: %v", err)
+		}
+		item.ID = p.ID
+		item.UserId = uid
+		item.PostId = p.ID
+		u.Avatar = s.avatarURLs(avatar)
+		p.User = &u
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return items, fmt.Errorf("can not iterate list timeline posts, error: %v", err)
+	}
+	return items, nil
+}
+
+// NotifyListMember tells a user they were added to a public list.
+func (s *Service) NotifyListMember(ownerID, memberID, listID int64) {
+	ctx := context.Background()
+	blocked, err := blockedBetween(ctx, s.Db, ownerID, memberID)
+	if err != nil {
+		log.Printf("can not check blocks before notifying list member: %v", err)
+		return
+	}
+	if blocked {
+		return
+	}
+	query := "INSERT INTO notifications (user_id, actor_ids, type, list_id) VALUES ($1, array[$2::INT], 'list_member', $3)"
+	if _, err = s.Db.Exec(ctx, query, memberID, ownerID, listID); err != nil {
+		log.Printf("can not create list member notification: %v", err)
+	}
+}
+
+// ownList returns ErrListNotFound or ErrListOwner unless the list belongs to the user.
+func ownList(ctx context.Context, q queryRower, uid, listID int64) error {
+	var ownerID int64
+	query := "SELECT user_id FROM lists WHERE id = $1"
+	err := q.QueryRow(ctx, query, listID).Scan(&ownerID)
+	if err == pgx.ErrNoRows {
+		return ErrListNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query list owner: %v", err)
+	}
+	if ownerID != uid {
+		return ErrListOwner
+	}
+	return nil
+}
+
+// listVisible returns ErrListNotFound when the list does not exist, is private to someone else
+// or its owner and the user blocked each other.
+func listVisible(ctx context.Context, q queryRower, uid, listID int64) error {
+	var visible bool
+	query := `SELECT (NOT is_private OR user_id = $2)
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = $2 AND blocks.blocked_id = lists.user_id) OR (blocks.blocker_id = lists.user_id AND blocks.blocked_id = $2))
+	FROM lists WHERE id = $1`
+	err := q.QueryRow(ctx, query, listID, uid).Scan(&visible)
+	if err == pgx.ErrNoRows || (err == nil && !visible) {
+		return ErrListNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query list visibility: %v", err)
+	}
+	return nil
+}
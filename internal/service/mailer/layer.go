@@ -0,0 +1,14 @@
+package mailer
+
+import "context"
+
+type MailerLayer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+//Message model
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,28 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Log writes every message to w instead of delivering it, use it for local development and tests.
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+func (m *Log) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n\n", msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("could not write mail to log: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const MutedWordMaxLength = 100
+
+var (
+	ErrInvalidMute        = errors.New("can not mute yourself")
+	ErrMutedWordNotFound  = errors.New("muted word not found")
+	ErrInvalidMuteExpiry  = errors.New("mute expiry must be in the future")
+	ErrMutedWordDuplicate = errors.New("word already muted")
+)
+
+// Mute model, a user hidden from the auth user without unfollowing
+type Mute struct {
+	Username  string     `json:"username"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// MutedWord model, a word or phrase hiding posts, comments and notifications containing it
+type MutedWord struct {
+	ID        int64      `json:"id"`
+	Phrase    string     `json:"phrase"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Mute hides the user's posts, comments and notifications from the auth user,
+// expiring after the given duration when not nil. The muted user is not told.
+func (s *Service) Mute(ctx context.Context, username string, expiresIn *time.Duration) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	if expiresIn != nil && *expiresIn <= 0 {
+		return ErrInvalidMuteExpiry
+	}
+
+	var mutedID int64
+	query := "SELECT id FROM users WHERE username = $1"
+	err := s.Db.QueryRow(ctx, query, username).Scan(&mutedID)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query id from given username, error %v", err)
+	}
+	if mutedID == uid {
+		return ErrInvalidMute
+	}
+
+	query = `INSERT INTO mutes (muter_id, muted_id, expires_at) VALUES ($1, $2, now() + $3::INTERVAL)
+	ON CONFLICT (muter_id, muted_id) DO UPDATE SET created_at = now(), expires_at = excluded.expires_at`
+	if _, err = s.Db.Exec(ctx, query, uid, mutedID, expiresIn); err != nil {
+		return fmt.Errorf("could not insert mute: %v", err)
+	}
+	return nil
+}
+
+// Unmute removes the auth user's mute of the given user.
+func (s *Service) Unmute(ctx context.Context, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "DELETE FROM mutes WHERE muter_id = $1 AND muted_id = (SELECT id FROM users WHERE username = $2)"
+	commandTag, err := s.Db.Exec(ctx, query, uid, username)
+	if err != nil {
+		return fmt.Errorf("could not delete mute: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Mutes lists the users currently muted by the auth user.
+func (s *Service) Mutes(ctx context.Context) ([]Mute, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	query := `SELECT users.username, mutes.created_at, mutes.expires_at FROM mutes
+	INNER JOIN users ON users.id = mutes.muted_id
+	WHERE mutes.muter_id = $1 AND (mutes.expires_at IS NULL OR mutes.expires_at > now())
+	ORDER BY mutes.created_at DESC`
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query mutes: %v", err)
+	}
+	defer rows.Close()
+
+	mm := []Mute{}
+	for rows.Next() {
+		var m Mute
+		if err = rows.Scan(&m.Username, &m.CreatedAt, &m.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("could not scan mute: %v", err)
+		}
+		mm = append(mm, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate mute rows: %v", err)
+	}
+	return mm, nil
+}
+
+// AddMutedWord mutes a word or phrase for the auth user. Matching is case insensitive.
+func (s *Service) AddMutedWord(ctx context.Context, phrase string, expiresIn *time.Duration) (MutedWord, error) {
+	var w MutedWord
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return w, ErrUnAuthorized
+	}
+	phrase = strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+	if phrase == "" || len(phrase) > MutedWordMaxLength {
+		return w, ErrValidations
+	}
+	if expiresIn != nil && *expiresIn <= 0 {
+		return w, ErrInvalidMuteExpiry
+	}
+
+	//expired words are never deleted, muting one again reuses its row
+	query := `INSERT INTO muted_words (user_id, phrase, expires_at) VALUES ($1, $2, now() + $3::INTERVAL)
+	ON CONFLICT (user_id, phrase) DO UPDATE SET created_at = now(), expires_at = excluded.expires_at
+	WHERE muted_words.expires_at <= now()
+	RETURNING id, created_at, expires_at`
+	err := s.Db.QueryRow(ctx, query, uid, phrase, expiresIn).Scan(&w.ID, &w.CreatedAt, &w.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return w, ErrMutedWordDuplicate
+	}
+	if err != nil {
+		return w, fmt.Errorf("could not insert muted word: %v", err)
+	}
+	w.Phrase = phrase
+	return w, nil
+}
+
+// MutedWords lists the words and phrases currently muted by the auth user.
+func (s *Service) MutedWords(ctx context.Context) ([]MutedWord, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	query := `SELECT id, phrase, created_at, expires_at FROM muted_words
+	WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now())
+	ORDER BY phrase`
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query muted words: %v", err)
+	}
+	defer rows.Close()
+
+	ww := []MutedWord{}
+	for rows.Next() {
+		var w MutedWord
+		if err = rows.Scan(&w.ID, &w.Phrase, &w.CreatedAt, &w.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("could not scan muted word: %v", err)
+		}
+		ww = append(ww, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate muted word rows: %v", err)
+	}
+	return ww, nil
+}
+
+// RemoveMutedWord unmutes one of the auth user's muted words.
+func (s *Service) RemoveMutedWord(ctx context.Context, wordID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "DELETE FROM muted_words WHERE id = $1 AND user_id = $2"
+	commandTag, err := s.Db.Exec(ctx, query, wordID, uid)
+	if err != nil {
+		return fmt.Errorf("could not delete muted word: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrMutedWordNotFound
+	}
+	return nil
+}
+
+// mutedFor reports if content by the author is muted for the user, either
+// through a mute of the author or a muted word it contains.
+func (s *Service) mutedFor(ctx context.Context, uid, authorID int64, content string) (bool, error) {
+	var muted bool
+	query := `SELECT EXISTS (SELECT 1 FROM mutes WHERE muter_id = $1 AND muted_id = $2 AND (expires_at IS NULL OR expires_at > now()))
+	OR EXISTS (SELECT 1 FROM muted_words WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now()) AND strpos(lower($3), phrase) > 0)`
+	if err := s.Db.QueryRow(ctx, query, uid, authorID, content).Scan(&muted); err != nil {
+		return false, fmt.Errorf("could not check mutes: %v", err)
+	}
+	return muted, nil
+}
@@ -14,10 +14,12 @@ type Notification struct {
 	ID        int64     `json:"id"`
 	UserId    int64     `json:"-"`
 	Type      string    `json:"type"`
-	Actors    []string  `json:"actor"`
+	ActorIDs  []int64   `json:"actor_ids"`
+	Actors    []string  `json:"actor"` //resolved from ActorIDs on read so renames show up
 	Issued_at time.Time `json:"issued_at"`
 	Read      bool      `json:"read"`
 	PostId    *int64    `json:"post_id,omitempty"`
+	ListId    *int64    `json:"list_id,omitempty"`
 }
 
 type TogglePostSubscriptionOutput struct {
@@ -63,9 +65,21 @@ func (s *Service) Notifications(ctx context.Context, last int, before string) ([
 		return nil, ErrUnAuthorized
 	}
 	query, args, err := buildQuery(`
-	SELECT id, user_id, actors, type, issued_at, read , post_id
+	SELECT id, user_id, actor_ids,
+	ARRAY(SELECT users.username FROM unnest(notifications.actor_ids) WITH ORDINALITY AS actor (id, ord)
+		INNER JOIN users ON users.id = actor.id
+		WHERE NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = actor.id
+			AND (mutes.expires_at IS NULL OR mutes.expires_at > now()))
+		ORDER BY actor.ord) AS actors,
+	type, issued_at, read , post_id, list_id
 	FROM notifications 
 	WHERE user_id = @uid
+	AND EXISTS (SELECT 1 FROM unnest(notifications.actor_ids) AS actor (id)
+		WHERE NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = actor.id
+			AND (mutes.expires_at IS NULL OR mutes.expires_at > now())))
+	AND (notifications.post_id IS NULL OR NOT EXISTS (SELECT 1 FROM posts INNER JOIN muted_words ON muted_words.user_id = @uid
+		AND (muted_words.expires_at IS NULL OR muted_words.expires_at > now()) AND strpos(lower(posts.content), muted_words.phrase) > 0
+		WHERE posts.id = notifications.post_id AND posts.user_id != @uid))
 	{{if .before}} 
 	AND id < @before
 	{{end}}
@@ -91,7 +105,7 @@ func (s *Service) Notifications(ctx context.Context, last int, before string) ([
 	var notifications []Notification
 	for rows.Next() {
 		var n Notification
-		dest := []interface{}{&n.ID, &n.UserId, &n.Actors, &n.Type, &n.Issued_at, &n.Read, &n.PostId}
+		dest := []interface{}{&n.ID, &n.UserId, &n.ActorIDs, &n.Actors, &n.Type, &n.Issued_at, &n.Read, &n.PostId, &n.ListId}
 		if err = rows.Scan(dest...); err != nil {
 			return nil, err
 		}
@@ -105,6 +119,15 @@ func (s *Service) Notifications(ctx context.Context, last int, before string) ([
 
 //notify follow notification
 func (s *Service) NotifyFollow(followerid, followingid int64) {
+	s.notifyFollower(followerid, followingid, "follow")
+}
+
+//notify follow request to a private account
+func (s *Service) NotifyFollowRequest(followerid, followingid int64) {
+	s.notifyFollower(followerid, followingid, "follow_request")
+}
+
+func (s *Service) notifyFollower(followerid, followingid int64, kind string) {
 	ctx := context.Background()
 	//Begin transasction
 	tx, err := s.Db.Begin(ctx)
@@ -114,17 +137,10 @@ func (s *Service) NotifyFollow(followerid, followingid int64) {
 	}
 	defer tx.Rollback(ctx)
 
-	query := "SELECT username from users where id = $1"
-	var actor string
-	if err := tx.QueryRow(ctx, query, followerid).Scan(&actor); err != nil {
-		log.Printf("can not get user by id during notifying the followee: %v", err)
-		return
-	}
-
 	//check if notification already exists
-	query = "Select Exists (SELECT 1 from notifications where user_id = $1 and $2::VARCHAR = any(actors) and type = 'follow')"
+	query := "Select Exists (SELECT 1 from notifications where user_id = $1 and $2::INT = any(actor_ids) and type = $3)"
 	var exists bool
-	if err := tx.QueryRow(ctx, query, followingid, actor).Scan(&exists); err != nil {
+	if err := tx.QueryRow(ctx, query, followingid, followerid, kind).Scan(&exists); err != nil {
 		log.Printf("can not check if notification exists: %v", err)
 		return
 	}
@@ -133,11 +149,11 @@ func (s *Service) NotifyFollow(followerid, followingid int64) {
 	}
 	var n Notification
 	//query to check if there is already a unread notification if not create a new one else update the existing one by appending the actor in that unread notification actors and update issued at returning id,actors,issued_at
-	query = "Select id from notifications where user_id = $1 and read = false and type = 'follow'"
-	if err = tx.QueryRow(ctx, query, followingid).Scan(&n.ID); err != nil {
+	query = "Select id from notifications where user_id = $1 and read = false and type = $2"
+	if err = tx.QueryRow(ctx, query, followingid, kind).Scan(&n.ID); err != nil {
 		if err == pgx.ErrNoRows {
-			query = "INSERT INTO notifications (user_id, actors, type) VALUES ($1, array[$2], 'follow') RETURNING id, actors, issued_at"
-			if err = tx.QueryRow(ctx, query, followingid, actor).Scan(&n.ID, &n.Actors, &n.Issued_at); err != nil {
+			query = "INSERT INTO notifications (user_id, actor_ids, type) VALUES ($1, array[$2::INT], $3) RETURNING id, actor_ids, issued_at"
+			if err = tx.QueryRow(ctx, query, followingid, followerid, kind).Scan(&n.ID, &n.ActorIDs, &n.Issued_at); err != nil {
 				log.Printf("can not create new notification: %v", err)
 				return
 			}
@@ -146,14 +162,14 @@ func (s *Service) NotifyFollow(followerid, followingid int64) {
 			return
 		}
 	} else {
-		query = "UPDATE notifications SET actors = array_append(actors, $1), issued_at = now() WHERE id = $2 RETURNING id, actors, issued_at"
-		if err = tx.QueryRow(ctx, query, actor, n.ID).Scan(&n.ID, &n.Actors, &n.Issued_at); err != nil {
+		query = "UPDATE notifications SET actor_ids = array_append(actor_ids, $1::INT), issued_at = now() WHERE id = $2 RETURNING id, actor_ids, issued_at"
+		if err = tx.QueryRow(ctx, query, followerid, n.ID).Scan(&n.ID, &n.ActorIDs, &n.Issued_at); err != nil {
 			log.Printf("can not update notification: %v", err)
 			return
 		}
 	}
 	n.UserId = followingid
-	n.Type = "follow"
+	n.Type = kind
 	n.Read = false
 	//commit the transaction
 	if err := tx.Commit(ctx); err != nil {
@@ -168,11 +184,11 @@ func (s *Service) NotifyFollow(followerid, followingid int64) {
 //Comment notification to all the users who commented on the post
 func (s *Service) NotifyComment(c Comment) {
 	ctx := context.Background()
-	actor := c.User.Username
+	actor := c.UserId
 
-	query := "Insert Into notifications (user_id, actors, type,post_id) Select user_id, array[$1], 'comment',$2 from post_subscriptions where post_id = $2 and user_id != $3 on Conflict (user_id, type,read,post_id) do update set actors = array_prepend($1,array_remove(notifications.actors,$1)),issued_at = now() Returning id,user_id,actors,issued_at"
+	query := "Insert Into notifications (user_id, actor_ids, type,post_id) Select user_id, array[$1::INT], 'comment',$2 from post_subscriptions where post_id = $2 and user_id != $1 and NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = post_subscriptions.user_id AND blocks.blocked_id = $1::INT) OR (blocks.blocker_id = $1::INT AND blocks.blocked_id = post_subscriptions.user_id)) on Conflict (user_id, type,read,post_id) do update set actor_ids = array_prepend($1::INT,array_remove(notifications.actor_ids,$1::INT)),issued_at = now() Returning id,user_id,actor_ids,issued_at"
 
-	rows, err := s.Db.Query(ctx, query, actor, c.PostId, c.UserId)
+	rows, err := s.Db.Query(ctx, query, actor, c.PostId)
 	if err != nil {
 		log.Printf("can not get subscribers: %v", err)
 		return
@@ -181,7 +197,7 @@ func (s *Service) NotifyComment(c Comment) {
 	var notifications []Notification
 	for rows.Next() {
 		var n Notification
-		dest := []interface{}{&n.ID, &n.UserId, &n.Actors, &n.Issued_at}
+		dest := []interface{}{&n.ID, &n.UserId, &n.ActorIDs, &n.Issued_at}
 		if err = rows.Scan(dest...); err != nil {
 			log.Printf("can not scan rows: %v", err)
 			return
@@ -215,6 +231,21 @@ func (s *Service) TogglePostSubscription(ctx context.Context, postid int64) (Tog
 	}
 	defer tx.Rollback(ctx)
 
+	blocked, err := postBlocked(ctx, tx, uid, postid)
+	if err != nil {
+		return output, err
+	}
+	if blocked {
+		return output, ErrPostNotFound
+	}
+	visible, err := postVisible(ctx, tx, uid, postid)
+	if err != nil {
+		return output, err
+	}
+	if !visible {
+		return output, ErrPrivateAccount
+	}
+
 	query := "Select Exists (Select 1 from post_subscriptions where user_id = $1 and post_id = $2)"
 
 	if err := tx.QueryRow(ctx, query, uid, postid).Scan(&output.Subscribed); err != nil {
@@ -249,15 +280,19 @@ func (s *Service) TogglePostSubscription(ctx context.Context, postid int64) (Tog
 
 //notify mention users
 func (s *Service) NotifyPostMention(p Post) {
+	s.notifyPostMentions(p, collectMentions(p.Content))
+}
+
+// notifyPostMentions notifies only the given usernames, edits pass the mentions the post did not have before.
+func (s *Service) notifyPostMentions(p Post, mentions []string) {
 	ctx := context.Background()
-	actor := p.User.Username
-	mentions := collectMentions(p.Content)
+	actor := p.UserId
 	if len(mentions) == 0 {
 		return
 	}
-	query := "Insert Into notifications (user_id, actors, type,post_id) Select id, array[$1], 'post_mention',$2 from users where users.id != $3 and users.username = any($4) Returning id,user_id,actors,issued_at"
+	query := "Insert Into notifications (user_id, actor_ids, type,post_id) Select id, array[$1::INT], 'post_mention',$2 from users where users.id != $1 and users.username = any($3) and NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = users.id AND blocks.blocked_id = $1::INT) OR (blocks.blocker_id = $1::INT AND blocks.blocked_id = users.id)) on Conflict (user_id, type,read,post_id) do nothing Returning id,user_id,actor_ids,issued_at"
 
-	rows, err := s.Db.Query(ctx, query, actor, p.ID, p.UserId, mentions)
+	rows, err := s.Db.Query(ctx, query, actor, p.ID, mentions)
 	if err != nil {
 		log.Printf("can not insert into post mention notification: %v", err)
 		return
@@ -266,7 +301,7 @@ func (s *Service) NotifyPostMention(p Post) {
 	var notifications []Notification
 	for rows.Next() {
 		var n Notification
-		dest := []interface{}{&n.ID, &n.UserId, &n.Actors, &n.Issued_at}
+		dest := []interface{}{&n.ID, &n.UserId, &n.ActorIDs, &n.Issued_at}
 		if err = rows.Scan(dest...); err != nil {
 			log.Printf("can not scan rows: %v", err)
 			return
@@ -286,14 +321,14 @@ func (s *Service) NotifyPostMention(p Post) {
 
 func (s *Service) NotifyCommentMention(c Comment) {
 	ctx := context.Background()
-	actor := c.User.Username
+	actor := c.UserId
 	mentions := collectMentions(c.Content)
 	if len(mentions) == 0 {
 		return
 	}
-	query := "Insert Into notifications (user_id, actors, type,post_id) Select id, array[$1], 'comment_mention',$2 from users where users.id != $3 and users.username = any($4) on Conflict (user_id, type,read,post_id) do update set actors = array_prepend($1,array_remove(notifications.actors,$1)),issued_at = now()  Returning id,user_id,actors,issued_at"
+	query := "Insert Into notifications (user_id, actor_ids, type,post_id) Select id, array[$1::INT], 'comment_mention',$2 from users where users.id != $1 and users.username = any($3) and NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = users.id AND blocks.blocked_id = $1::INT) OR (blocks.blocker_id = $1::INT AND blocks.blocked_id = users.id)) on Conflict (user_id, type,read,post_id) do update set actor_ids = array_prepend($1::INT,array_remove(notifications.actor_ids,$1::INT)),issued_at = now()  Returning id,user_id,actor_ids,issued_at"
 
-	rows, err := s.Db.Query(ctx, query, actor, c.PostId, c.UserId, mentions)
+	rows, err := s.Db.Query(ctx, query, actor, c.PostId, mentions)
 	if err != nil {
 		log.Printf("can not insert comment mention notification: %v", err)
 		return
@@ -302,7 +337,7 @@ func (s *Service) NotifyCommentMention(c Comment) {
 	var notifications []Notification
 	for rows.Next() {
 		var n Notification
-		dest := []interface{}{&n.ID, &n.UserId, &n.Actors, &n.Issued_at}
+		dest := []interface{}{&n.ID, &n.UserId, &n.ActorIDs, &n.Issued_at}
 		if err = rows.Scan(dest...); err != nil {
 			log.Printf("can not scan rows: %v", err)
 			return
@@ -0,0 +1,192 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const mockKeyID = "mock"
+
+// MockIssuer is a tiny local OpenID Connect issuer for tests and development.
+// It signs in whoever Subject and Email describe without asking anything.
+//
+//	m, _ := oidc.NewMockIssuer("client", "secret")
+//	srv := httptest.NewServer(m)
+//	m.URL = srv.URL
+type MockIssuer struct {
+	URL           string
+	ClientID      string
+	ClientSecret  string
+	Subject       string
+	Email         string
+	EmailVerified bool
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	nonce       string
+	redirectURI string
+	subject     string
+	email       string
+	verified    bool
+}
+
+func NewMockIssuer(clientID, clientSecret string) (*MockIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate mock issuer key: %v", err)
+	}
+	return &MockIssuer{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Subject:       "mock-user",
+		Email:         "mock@example.com",
+		EmailVerified: true,
+		key:           key,
+		codes:         map[string]mockGrant{},
+	}, nil
+}
+
+func (m *MockIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		m.writeJSON(w, discovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/jwks":
+		m.writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != m.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code, err := gonanoid.New()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	m.codes[code] = mockGrant{
+		nonce:       q.Get("nonce"),
+		redirectURI: redirectURI.String(),
+		subject:     m.Subject,
+		email:       m.Email,
+		verified:    m.EmailVerified,
+	}
+	m.mu.Unlock()
+
+	v := redirectURI.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirectURI.RawQuery = v.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != m.ClientID || secret != m.ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	m.mu.Lock()
+	grant, ok := m.codes[code]
+	delete(m.codes, code)
+	m.mu.Unlock()
+	if !ok || grant.redirectURI != r.PostFormValue("redirect_uri") {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	idToken, err := m.sign(map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            grant.subject,
+		"aud":            m.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.email,
+		"email_verified": grant.verified,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.writeJSON(w, map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (m *MockIssuer) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": mockKeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (m *MockIssuer) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,308 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidIDToken    = errors.New("invalid id token")
+	ErrUnknownSigningKey = errors.New("id token signed with unknown key")
+)
+
+// Config of a provider, loaded at startup
+type Config struct {
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// IDToken claims we care about
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Nonce         string
+}
+
+// Provider talks to a standards compliant OpenID Connect issuer using the authorization code flow.
+type Provider struct {
+	Config
+	RedirectURL string
+
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	client                *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads the issuer metadata from its well known configuration document.
+func Discover(ctx context.Context, cfg Config, redirectURL string) (*Provider, error) {
+	p := &Provider{
+		Config:      cfg,
+		RedirectURL: redirectURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		keys:        map[string]*rsa.PublicKey{},
+	}
+	var d discovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(cfg.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("could not discover %s: %v", cfg.Issuer, err)
+	}
+	if d.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("issuer mismatch, configured %q but discovered %q", cfg.Issuer, d.Issuer)
+	}
+	p.authorizationEndpoint = d.AuthorizationEndpoint
+	p.tokenEndpoint = d.TokenEndpoint
+	p.jwksURI = d.JWKSURI
+	return p, nil
+}
+
+// AuthCodeURL is where the user gets redirected to sign in with the provider.
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", "openid email profile")
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	sep := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades the authorization code for tokens and returns the verified id token.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (IDToken, error) {
+	var idToken IDToken
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return idToken, fmt.Errorf("could not create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return idToken, fmt.Errorf("could not exchange code: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(res.Body)
+		return idToken, fmt.Errorf("could not exchange code, provider responded %d: %s", res.StatusCode, b)
+	}
+	var out struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return idToken, fmt.Errorf("could not decode token response: %v", err)
+	}
+	if out.IDToken == "" {
+		return idToken, ErrInvalidIDToken
+	}
+
+	return p.Verify(ctx, out.IDToken, nonce)
+}
+
+// Verify checks the RS256 signature, issuer, audience, expiry and nonce of a raw id token.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (IDToken, error) {
+	var idToken IDToken
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return idToken, ErrInvalidIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return idToken, ErrInvalidIDToken
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return idToken, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+
+	var claims struct {
+		Iss           string          `json:"iss"`
+		Sub           string          `json:"sub"`
+		Aud           json.RawMessage `json:"aud"`
+		Exp           int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified interface{}     `json:"email_verified"`
+	}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return idToken, ErrInvalidIDToken
+	}
+	if claims.Iss != p.Issuer || claims.Sub == "" || !audienceContains(claims.Aud, p.ClientID) {
+		return idToken, ErrInvalidIDToken
+	}
+	if time.Now().Unix() > claims.Exp {
+		return idToken, ErrInvalidIDToken
+	}
+	if claims.Nonce != nonce {
+		return idToken, ErrInvalidIDToken
+	}
+
+	idToken.Issuer = claims.Iss
+	idToken.Subject = claims.Sub
+	idToken.Email = strings.ToLower(claims.Email)
+	idToken.Nonce = claims.Nonce
+	//some providers send email_verified as a string
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		idToken.EmailVerified = v
+	case string:
+		idToken.EmailVerified = v == "true"
+	}
+	return idToken, nil
+}
+
+// key returns the signing key with the given id, refreshing the key set once when it is unknown.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.RLock()
+	k, ok := p.keys[kid]
+	p.mu.RUnlock()
+	if ok {
+		return k, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("could not fetch signing keys: %v", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if k, ok = keys[kid]; !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	return k, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, u)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// audienceContains handles aud being either a string or an array of strings.
+func audienceContains(raw json.RawMessage, clientID string) bool {
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return one == clientID
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return false
+	}
+	for _, a := range many {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfigs reads providers from a json file shaped like {"providers": [{"name": "...", "issuer": "...", "client_id": "...", "client_secret": "..."}]}.
+func LoadConfigs(path string) ([]Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read oidc providers file: %v", err)
+	}
+	var file struct {
+		Providers []Config `json:"providers"`
+	}
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("could not parse oidc providers file: %v", err)
+	}
+	for _, cfg := range file.Providers {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider needs a name, issuer and client_id: %+v", cfg.Name)
+		}
+	}
+	return file.Providers, nil
+}
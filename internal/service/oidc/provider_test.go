@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newMockProvider(t *testing.T) (*MockIssuer, *Provider) {
+	t.Helper()
+	m, err := NewMockIssuer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	m.URL = srv.URL
+
+	p, err := Discover(context.Background(), Config{Name: "mock", Issuer: m.URL, ClientID: "client", ClientSecret: "secret"}, "http://localhost/oauth/mock/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, p
+}
+
+// authorize follows the provider sign in and returns the callback query.
+func authorize(t *testing.T, p *Provider, state, nonce string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(p.AuthCodeURL(state, nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", res.StatusCode, http.StatusFound)
+	}
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Path != "/oauth/mock/callback" {
+		t.Fatalf("redirected to %s", callback)
+	}
+	return callback.Query()
+}
+
+func TestCodeFlow(t *testing.T) {
+	m, p := newMockProvider(t)
+	m.Subject = "42"
+	m.Email = "Alice@Example.com"
+
+	q := authorize(t, p, "state", "nonce")
+	if q.Get("state") != "state" {
+		t.Fatalf("state = %q, want %q", q.Get("state"), "state")
+	}
+	idToken, err := p.Exchange(context.Background(), q.Get("code"), "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != "42" || idToken.Email != "alice@example.com" || !idToken.EmailVerified || idToken.Issuer != m.URL {
+		t.Fatalf("id token = %+v", idToken)
+	}
+
+	//codes are single use
+	if _, err = p.Exchange(context.Background(), q.Get("code"), "nonce"); err == nil {
+		t.Fatal("code exchanged twice")
+	}
+}
+
+func TestCodeFlowNonceMismatch(t *testing.T) {
+	_, p := newMockProvider(t)
+	q := authorize(t, p, "state", "nonce")
+	if _, err := p.Exchange(context.Background(), q.Get("code"), "other nonce"); err != ErrInvalidIDToken {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestVerifyOtherIssuer(t *testing.T) {
+	_, p := newMockProvider(t)
+	other, err := NewMockIssuer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.URL = p.Issuer
+	raw, err := other.sign(map[string]interface{}{"iss": p.Issuer, "sub": "42", "aud": "client", "exp": 1 << 40, "nonce": "nonce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//same key id, different key
+	if _, err = p.Verify(context.Background(), raw, "nonce"); err != ErrInvalidIDToken {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
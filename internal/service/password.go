@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/paritoshyadav/socialnetwork/internal/service/mailer"
+	"golang.org/x/crypto/argon2"
+)
+
+const PasswordResetLifetime = time.Hour
+
+var (
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrInvalidPasswordHash  = errors.New("invalid password hash")
+	ErrWrongCurrentPassword = errors.New("current password is wrong")
+)
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+// passwordParams are used for every new hash, stored hashes with other params are upgraded on login.
+var passwordParams = argon2Params{
+	memory:      64 * 1024,
+	iterations:  3,
+	parallelism: 2,
+	saltLength:  16,
+	keyLength:   32,
+}
+
+// hashPassword encodes the argon2id hash in the PHC string format.
+func hashPassword(password string) (string, error) {
+	p := passwordParams
+	salt := make([]byte, p.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not generate password salt: %v", err)
+	}
+	hash := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// comparePassword reports if password matches the encoded hash and if the hash should be upgraded.
+func comparePassword(password, encoded string) (match bool, rehash bool, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	var p argon2Params
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrInvalidPasswordHash
+	}
+	p.saltLength = uint32(len(salt))
+	p.keyLength = uint32(len(hash))
+
+	other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+	if subtle.ConstantTimeCompare(hash, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, version != argon2.Version || p != passwordParams, nil
+}
+
+// PasswordLogin logs the user in with email and password.
+func (s *Service) PasswordLogin(ctx context.Context, email, password string) (LoginOutput, error) {
+	var lo LoginOutput
+	var uid int64
+	var encoded *string
+	query := "SELECT id, password_hash FROM users WHERE email = $1"
+	err := s.Db.QueryRow(ctx, query, email).Scan(&uid, &encoded)
+	if err == pgx.ErrNoRows {
+		return lo, ErrInvalidCredentials
+	}
+	if err != nil {
+		return lo, fmt.Errorf("could not query the user: %v", err)
+	}
+	if encoded == nil {
+		return lo, ErrInvalidCredentials
+	}
+
+	match, rehash, err := comparePassword(password, *encoded)
+	if err != nil {
+		return lo, err
+	}
+	if !match {
+		return lo, ErrInvalidCredentials
+	}
+
+	if rehash {
+		if err = s.setPassword(ctx, uid, password); err != nil {
+			log.Printf("could not upgrade password hash of user %d: %v", uid, err)
+		}
+	}
+
+	return s.completeLogin(ctx, uid)
+}
+
+// ChangePassword sets a new password for the auth user.
+// The current password is only required when the account already has one.
+func (s *Service) ChangePassword(ctx context.Context, currentPassword *string, newPassword string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	var encoded *string
+	query := "SELECT password_hash FROM users WHERE id = $1"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&encoded)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user password: %v", err)
+	}
+
+	if encoded != nil {
+		if currentPassword == nil {
+			return ErrWrongCurrentPassword
+		}
+		match, _, err := comparePassword(*currentPassword, *encoded)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return ErrWrongCurrentPassword
+		}
+	}
+
+	newEncoded, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the change password transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query = "UPDATE users SET password_hash = $1 WHERE id = $2"
+	if _, err = tx.Exec(ctx, query, newEncoded, uid); err != nil {
+		return fmt.Errorf("could not update password: %v", err)
+	}
+
+	//like ResetPassword, except the session making the change
+	current, _ := ctx.Value(KeyAuthSessionID).(int64)
+	query = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id != $2 AND revoked_at IS NULL"
+	if _, err = tx.Exec(ctx, query, uid, current); err != nil {
+		return fmt.Errorf("could not revoke sessions after password change: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the change password transcation, error: %v", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset emails a reset link to the given address.
+// Unknown emails are ignored silently like Login does.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	var uid int64
+	query := "SELECT id FROM users WHERE email = $1"
+	err := s.Db.QueryRow(ctx, query, email).Scan(&uid)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user: %v", err)
+	}
+
+	token, err := gonanoid.New(32)
+	if err != nil {
+		return fmt.Errorf("could not generate password reset token: %v", err)
+	}
+
+	query = "INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, now() + $3::INTERVAL)"
+	if _, err = s.Db.Exec(ctx, query, uid, hashSecret(token), PasswordResetLifetime); err != nil {
+		return fmt.Errorf("could not insert password reset token: %v", err)
+	}
+
+	link, err := url.Parse(s.PasswordResetURL)
+	if err != nil {
+		return fmt.Errorf("could not parse password reset url: %v", err)
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	err = s.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your Socially password",
+		Body:    fmt.Sprintf("Use the link below to choose a new password, it expires in %d minutes.\nIf you did not ask for it you can ignore this email.\n\n%s\n", int(PasswordResetLifetime.Minutes()), link.String()),
+	})
+	if err != nil {
+		return fmt.Errorf("could not send password reset link: %v", err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes a reset token and sets the new password.
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	encoded, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the password reset transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var uid int64
+	query := "UPDATE password_resets SET used_at = now() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() RETURNING user_id"
+	err = tx.QueryRow(ctx, query, hashSecret(token)).Scan(&uid)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("could not consume password reset token: %v", err)
+	}
+
+	query = "UPDATE users SET password_hash = $1 WHERE id = $2"
+	if _, err = tx.Exec(ctx, query, encoded, uid); err != nil {
+		return fmt.Errorf("could not update password: %v", err)
+	}
+
+	query = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not revoke sessions after password reset: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the password reset transcation, error: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Service) setPassword(ctx context.Context, uid int64, password string) error {
+	encoded, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE users SET password_hash = $1 WHERE id = $2"
+	if _, err = s.Db.Exec(ctx, query, encoded, uid); err != nil {
+		return fmt.Errorf("could not update password: %v", err)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/sanity-io/litter"
 )
 
@@ -45,6 +46,9 @@ func (s *Service) CreatePost(ctx context.Context, content string, spoilerOf *str
 	if !ok {
 		return ti, ErrUnAuthorized
 	}
+	if err := s.ensureVerified(ctx, uid); err != nil {
+		return ti, err
+	}
 	//Begin transasction
 	tx, err := s.Db.Begin(ctx)
 	if err != nil {
@@ -152,6 +156,20 @@ func (s *Service) TogglePostLike(ctx context.Context, postId int64) (TogglePostL
 		return tpl, fmt.Errorf("can not start the post likke transcation, error: %v", err)
 	}
 	defer tx.Rollback(ctx)
+	blocked, err := postBlocked(ctx, tx, uid, postId)
+	if err != nil {
+		return tpl, err
+	}
+	if blocked {
+		return tpl, ErrPostNotFound
+	}
+	visible, err := postVisible(ctx, tx, uid, postId)
+	if err != nil {
+		return tpl, err
+	}
+	if !visible {
+		return tpl, ErrPrivateAccount
+	}
 	//query to check if user liked the post
 	query := "SELECT EXISTS (SELECT 1 FROM likes WHERE user_id = $1 AND post_id = $2)"
 	err = tx.QueryRow(ctx, query, uid, postId).Scan(&tpl.Liked)
@@ -208,7 +226,10 @@ func (s *Service) PostsByUser(ctx context.Context, username string, last int, be
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 
 	var posts []Post
-	query, args, err := buildQuery(`SELECT id,content, created_at,likes_count,spoiler,nsfw,comments_count
+	if err := s.ensureProfileVisible(ctx, username); err != nil {
+		return posts, err
+	}
+	query, args, err := buildQuery(`SELECT id,content, created_at,updated_at,likes_count,spoiler,nsfw,comments_count
 	{{if .auth}}
 	,posts.user_id = @uid As mine
 	,likes.user_id is not null As liked
@@ -220,6 +241,9 @@ func (s *Service) PostsByUser(ctx context.Context, username string, last int, be
 	LEFT JOIN post_subscriptions ON post_subscriptions.post_id = posts.id AND post_subscriptions.user_id = @uid	
 	{{end}}
 	WHERE posts.user_id = (SELECT id FROM users WHERE username = @username)
+	{{if .auth}}
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = posts.user_id) OR (blocks.blocker_id = posts.user_id AND blocks.blocked_id = @uid))
+	{{end}}
 	{{if .before}}
 	AND posts.id < @before
 	{{end}}
@@ -245,7 +269,7 @@ func (s *Service) PostsByUser(ctx context.Context, username string, last int, be
 
 	for rows.Next() {
 		var p Post
-		dest := []interface{}{&p.ID, &p.Content, &p.CreatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &p.CommentsCount}
+		dest := []interface{}{&p.ID, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &p.CommentsCount}
 		if auth {
 			dest = append(dest, &p.IsMe, &p.Liked, &p.Subscribed)
 		}
@@ -263,7 +287,7 @@ func (s *Service) Post(ctx context.Context, id int64) (Post, error) {
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 
 	var p Post
-	query, args, err := buildQuery(`SELECT posts.id,content, created_at,likes_count,spoiler,nsfw,comments_count 
+	query, args, err := buildQuery(`SELECT posts.id,content, created_at,updated_at,likes_count,spoiler,nsfw,comments_count 
 	,users.username As username
 	,users.avatar As avatar_url
 	{{if .auth}}
@@ -280,6 +304,11 @@ func (s *Service) Post(ctx context.Context, id int64) (Post, error) {
 	LEFT JOIN post_subscriptions ON post_subscriptions.post_id = posts.id AND post_subscriptions.user_id = @uid	
 	{{end}}
 	WHERE posts.id = @id
+	AND (NOT users.is_private {{if .auth}} OR users.id = @uid
+		OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @uid AND follows.following_id = users.id) {{end}})
+	{{if .auth}}
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = posts.user_id) OR (blocks.blocker_id = posts.user_id AND blocks.blocked_id = @uid))
+	{{end}}
 	order by posts.id desc	
 	`, map[string]interface{}{
 		"auth": auth,
@@ -291,20 +320,93 @@ func (s *Service) Post(ctx context.Context, id int64) (Post, error) {
 	}
 	var u User
 	var avatar sql.NullString
-	dest := []interface{}{&p.ID, &p.Content, &p.CreatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &p.CommentsCount, &u.Username, &avatar}
+	dest := []interface{}{&p.ID, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &p.CommentsCount, &u.Username, &avatar}
 	if auth {
 
 		dest = append(dest, &p.IsMe, &p.Liked, &p.Subscribed)
 	}
 	err = s.Db.QueryRow(ctx, query, args...).Scan(dest...)
+	if err == pgx.ErrNoRows {
+		return p, ErrPostNotFound
+	}
 	if err != nil {
 		return p, fmt.Errorf("can not get posts, error: %v", err)
 	}
-	if avatar.Valid {
-		url := s.Origin + "/img/avatars" + avatar.String
-		u.AvatarUrl = &url
-	}
+	u.Avatar = s.avatarURLs(avatar)
 	p.User = &u
 
 	return p, nil
 }
+
+// DeletePost removes a post of the auth user with its comments, likes, subscriptions and notifications,
+// and tells the live timelines that had it to drop it.
+func (s *Service) DeletePost(ctx context.Context, postID int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the delete post transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var authorID int64
+	query := "SELECT user_id FROM posts WHERE id = $1 FOR UPDATE"
+	err = tx.QueryRow(ctx, query, postID).Scan(&authorID)
+	if err == pgx.ErrNoRows {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("can not query the post, error: %v", err)
+	}
+	if authorID != uid {
+		return ErrNotPostAuthor
+	}
+
+	//timeline items are kept to notify the live timelines after commit
+	var items []TimelineItem
+	rows, err := tx.Query(ctx, "DELETE FROM timelines WHERE post_id = $1 RETURNING id, user_id", postID)
+	if err != nil {
+		return fmt.Errorf("can not delete timeline items, error: %v", err)
+	}
+	for rows.Next() {
+		t := TimelineItem{PostId: postID, Post: Post{ID: postID, UserId: authorID}, Event: TimelineEventDelete}
+		if err = rows.Scan(&t.ID, &t.UserId); err != nil {
+			rows.Close()
+			return fmt.Errorf("can not scan deleted timeline item, error: %v", err)
+		}
+		items = append(items, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("can not iterate deleted timeline items, error: %v", err)
+	}
+
+	steps := []struct {
+		query string
+		what  string
+	}{
+		{"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = $1)", "delete likes of comments"},
+		{"DELETE FROM comments WHERE post_id = $1", "delete comments"},
+		{"DELETE FROM likes WHERE post_id = $1", "delete likes"},
+		{"DELETE FROM post_subscriptions WHERE post_id = $1", "delete post subscriptions"},
+		{"DELETE FROM notifications WHERE post_id = $1", "delete notifications"},
+		{"DELETE FROM post_revisions WHERE post_id = $1", "delete post revisions"},
+		{"DELETE FROM posts WHERE id = $1", "delete post"},
+	}
+	for _, step := range steps {
+		if _, err = tx.Exec(ctx, step.query, postID); err != nil {
+			return fmt.Errorf("can not %s, error: %v", step.what, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the delete post transcation, error: %v", err)
+	}
+
+	for _, t := range items {
+		go s.broadcastTimelineItem(t)
+	}
+	return nil
+}
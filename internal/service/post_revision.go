@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	DefaultPostEditWindow = 15 * time.Minute
+	PostContentMaxLength  = 100
+	SpoilerMaxLength      = 50
+)
+
+var (
+	ErrNotPostAuthor       = errors.New("post belongs to another user")
+	ErrPostEditWindowEnded = errors.New("post can not be edited anymore")
+)
+
+// UpdatePostInput fields left nil keep their value, an empty SpoilerOf removes the spoiler.
+type UpdatePostInput struct {
+	Content   *string
+	SpoilerOf *string
+	NSFW      *bool
+}
+
+// changes reports if applying the input to the post would change anything.
+func (in UpdatePostInput) changes(p Post) bool {
+	if in.Content != nil && *in.Content != p.Content {
+		return true
+	}
+	if in.SpoilerOf != nil {
+		var old string
+		if p.SpoilerOf != nil {
+			old = *p.SpoilerOf
+		}
+		if *in.SpoilerOf != old {
+			return true
+		}
+	}
+	return in.NSFW != nil && *in.NSFW != p.NSFW
+}
+
+// PostRevision is a previous version of an edited post.
+type PostRevision struct {
+	ID         int64     `json:"id"`
+	Content    string    `json:"content"`
+	SpoilerOf  *string   `json:"spoiler_of"`
+	NSFW       bool      `json:"nsfw"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// UpdatePost edits a post of the auth user within the edit window keeping the previous version as a revision.
+func (s *Service) UpdatePost(ctx context.Context, postID int64, in UpdatePostInput) (Post, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return Post{}, ErrUnAuthorized
+	}
+	if in.Content == nil && in.SpoilerOf == nil && in.NSFW == nil {
+		return Post{}, ErrValidations
+	}
+	if in.Content != nil {
+		*in.Content = strings.TrimSpace(*in.Content)
+		if *in.Content == "" || utf8.RuneCountInString(*in.Content) > PostContentMaxLength {
+			return Post{}, ErrValidations
+		}
+	}
+	if in.SpoilerOf != nil {
+		*in.SpoilerOf = strings.TrimSpace(*in.SpoilerOf)
+		if utf8.RuneCountInString(*in.SpoilerOf) > SpoilerMaxLength {
+			return Post{}, ErrValidations
+		}
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return Post{}, fmt.Errorf("can not start the update post transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old Post
+	query := "SELECT user_id, content, spoiler, nsfw, created_at, updated_at FROM posts WHERE id = $1 FOR UPDATE"
+	err = tx.QueryRow(ctx, query, postID).Scan(&old.UserId, &old.Content, &old.SpoilerOf, &old.NSFW, &old.CreatedAt, &old.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return Post{}, fmt.Errorf("can not query the post, error: %v", err)
+	}
+	if old.UserId != uid {
+		return Post{}, ErrNotPostAuthor
+	}
+	if s.Clock().UTC().Sub(old.CreatedAt) > s.PostEditWindow {
+		return Post{}, ErrPostEditWindowEnded
+	}
+	if !in.changes(old) {
+		//nothing to keep a revision of
+		tx.Rollback(ctx)
+		return s.Post(ctx, postID)
+	}
+
+	query = "INSERT INTO post_revisions (post_id, content, spoiler, nsfw, created_at) VALUES ($1, $2, $3, $4, $5)"
+	if _, err = tx.Exec(ctx, query, postID, old.Content, old.SpoilerOf, old.NSFW, old.UpdatedAt); err != nil {
+		return Post{}, fmt.Errorf("can not save post revision, error: %v", err)
+	}
+
+	query, args, err := buildQuery(`UPDATE posts SET
+	content = {{if .setContent}} @content {{else}} content {{end}},
+	spoiler = {{if .setSpoiler}} NULLIF(@spoiler, '') {{else}} spoiler {{end}},
+	nsfw = {{if .setNSFW}} @nsfw {{else}} nsfw {{end}},
+	updated_at = now()
+	WHERE id = @id`, map[string]interface{}{
+		"setContent": in.Content != nil,
+		"content":    in.Content,
+		"setSpoiler": in.SpoilerOf != nil,
+		"spoiler":    in.SpoilerOf,
+		"setNSFW":    in.NSFW != nil,
+		"nsfw":       in.NSFW,
+		"id":         postID,
+	})
+	if err != nil {
+		return Post{}, fmt.Errorf("can not build update post query, error: %v", err)
+	}
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return Post{}, fmt.Errorf("can not update post, error: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Post{}, fmt.Errorf("can not commit the update post transcation, error: %v", err)
+	}
+
+	p, err := s.Post(ctx, postID)
+	if err != nil {
+		return p, err
+	}
+	p.UserId = uid
+	go s.postEdited(p, old.Content)
+	return p, nil
+}
+
+// postEdited notifies the users mentioned for the first time and pushes the new version to live timelines.
+func (s *Service) postEdited(p Post, oldContent string) {
+	ctx := context.Background()
+	previous := map[string]bool{}
+	for _, m := range collectMentions(oldContent) {
+		previous[m] = true
+	}
+	var added []string
+	for _, m := range collectMentions(p.Content) {
+		if !previous[m] {
+			added = append(added, m)
+		}
+	}
+	go s.notifyPostMentions(p, added)
+
+	p.IsMe = false
+	p.Liked = false
+	p.Subscribed = false
+	rows, err := s.Db.Query(ctx, "SELECT id, user_id FROM timelines WHERE post_id = $1", p.ID)
+	if err != nil {
+		log.Printf("can not query timelines of edited post: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := TimelineItem{PostId: p.ID, Post: p, Event: TimelineEventEdit}
+		if err = rows.Scan(&t.ID, &t.UserId); err != nil {
+			log.Printf("can not scan timeline of edited post: %v", err)
+			return
+		}
+		go s.broadcastTimelineItem(t)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("can not iterate timelines of edited post: %v", err)
+	}
+}
+
+// PostRevisions lists the previous versions of a post, newest first.
+func (s *Service) PostRevisions(ctx context.Context, postID int64) ([]PostRevision, error) {
+	//same visibility as the post itself
+	if _, err := s.Post(ctx, postID); err != nil {
+		return nil, err
+	}
+	query := `SELECT id, content, spoiler, nsfw, created_at, replaced_at FROM post_revisions
+	WHERE post_id = $1 ORDER BY id DESC`
+	rows, err := s.Db.Query(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("can not query post revisions, error: %v", err)
+	}
+	defer rows.Close()
+	rr := []PostRevision{}
+	for rows.Next() {
+		var r PostRevision
+		if err = rows.Scan(&r.ID, &r.Content, &r.SpoilerOf, &r.NSFW, &r.CreatedAt, &r.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("can not scan post revision, error: %v", err)
+		}
+		rr = append(rr, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("can not iterate post revisions, error: %v", err)
+	}
+	return rr, nil
+}
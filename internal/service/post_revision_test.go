@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpdatePostInputChanges(t *testing.T) {
+	spoiler := "movie"
+	post := Post{Content: "hello", SpoilerOf: &spoiler, NSFW: true}
+	yes, no := true, false
+	tests := []struct {
+		name string
+		in   UpdatePostInput
+		want bool
+	}{
+		{"same content", UpdatePostInput{Content: strPtr("hello")}, false},
+		{"same spoiler", UpdatePostInput{SpoilerOf: strPtr("movie")}, false},
+		{"same nsfw", UpdatePostInput{NSFW: &yes}, false},
+		{"same everything", UpdatePostInput{Content: strPtr("hello"), SpoilerOf: strPtr("movie"), NSFW: &yes}, false},
+		{"new content", UpdatePostInput{Content: strPtr("hello!")}, true},
+		{"removed spoiler", UpdatePostInput{SpoilerOf: strPtr("")}, true},
+		{"new nsfw", UpdatePostInput{NSFW: &no}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.in.changes(post); got != tt.want {
+			t.Errorf("%s: changes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	//removing a spoiler the post does not have changes nothing
+	if (UpdatePostInput{SpoilerOf: strPtr("")}).changes(Post{Content: "hello"}) {
+		t.Error("removing a missing spoiler is a change")
+	}
+}
+
+func TestUpdatePostWithoutFields(t *testing.T) {
+	s := &Service{}
+	ctx := context.WithValue(context.Background(), KeyAuthUserID, int64(1))
+	if _, err := s.UpdatePost(ctx, 1, UpdatePostInput{}); err != ErrValidations {
+		t.Fatalf("err = %v, want %v", err, ErrValidations)
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrPrivateAccount        = errors.New("account is private")
+	ErrFollowRequestNotFound = errors.New("follow request not found")
+)
+
+// FollowRequest model, a pending follow of a private account
+type FollowRequest struct {
+	User      User      `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetPrivate switches the auth user's account between private and public.
+// Going public approves every pending follow request.
+func (s *Service) SetPrivate(ctx context.Context, private bool) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the account privacy transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := "UPDATE users SET is_private = $1 WHERE id = $2"
+	commandTag, err := tx.Exec(ctx, query, private, uid)
+	if err != nil {
+		return fmt.Errorf("could not update account privacy: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	if !private {
+		query = "SELECT requester_id FROM follow_requests WHERE target_id = $1"
+		rows, err := tx.Query(ctx, query, uid)
+		if err != nil {
+			return fmt.Errorf("could not query follow requests: %v", err)
+		}
+		var requesters []int64
+		for rows.Next() {
+			var requesterID int64
+			if err = rows.Scan(&requesterID); err != nil {
+				rows.Close()
+				return fmt.Errorf("could not scan follow request: %v", err)
+			}
+			requesters = append(requesters, requesterID)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("could not iterate follow request rows: %v", err)
+		}
+		for _, requesterID := range requesters {
+			if err = approveFollowRequest(ctx, tx, requesterID, uid); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the account privacy transcation, error: %v", err)
+	}
+	return nil
+}
+
+// FollowRequests lists the pending follow requests of the auth user, newest first.
+func (s *Service) FollowRequests(ctx context.Context) ([]FollowRequest, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	query := `SELECT users.username, users.avatar, follow_requests.created_at FROM follow_requests
+	INNER JOIN users ON users.id = follow_requests.requester_id
+	WHERE follow_requests.target_id = $1
+	ORDER BY follow_requests.created_at DESC`
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query follow requests: %v", err)
+	}
+	defer rows.Close()
+
+	rr := []FollowRequest{}
+	for rows.Next() {
+		var r FollowRequest
+		var avatar sql.NullString
+		if err = rows.Scan(&r.User.Username, &avatar, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan follow request: %v", err)
+		}
+		r.User.Avatar = s.avatarURLs(avatar)
+		rr = append(rr, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate follow request rows: %v", err)
+	}
+	return rr, nil
+}
+
+// ApproveFollowRequest turns the pending request of the given user into a follow.
+func (s *Service) ApproveFollowRequest(ctx context.Context, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the approve follow request transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var requesterID int64
+	query := "SELECT id FROM users WHERE username = $1"
+	err = tx.QueryRow(ctx, query, username).Scan(&requesterID)
+	if err == pgx.ErrNoRows {
+		return ErrFollowRequestNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query id from given username, error %v", err)
+	}
+	if err = approveFollowRequest(ctx, tx, requesterID, uid); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the approve follow request transcation, error: %v", err)
+	}
+	return nil
+}
+
+// RejectFollowRequest drops the pending request of the given user.
+func (s *Service) RejectFollowRequest(ctx context.Context, username string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "DELETE FROM follow_requests WHERE target_id = $1 AND requester_id = (SELECT id FROM users WHERE username = $2)"
+	commandTag, err := s.Db.Exec(ctx, query, uid, username)
+	if err != nil {
+		return fmt.Errorf("could not delete follow request: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrFollowRequestNotFound
+	}
+	return nil
+}
+
+func approveFollowRequest(ctx context.Context, tx pgx.Tx, requesterID, targetID int64) error {
+	query := "DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2"
+	commandTag, err := tx.Exec(ctx, query, requesterID, targetID)
+	if err != nil {
+		return fmt.Errorf("could not delete follow request: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrFollowRequestNotFound
+	}
+	query = "INSERT INTO follows (follower_id, following_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	if commandTag, err = tx.Exec(ctx, query, requesterID, targetID); err != nil {
+		return fmt.Errorf("could not insert follow: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return nil
+	}
+	query = "UPDATE users SET followings_count = followings_count + 1 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, requesterID); err != nil {
+		return fmt.Errorf("could to update user following count: %v", err)
+	}
+	query = "UPDATE users SET followers_count = followers_count + 1 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, targetID); err != nil {
+		return fmt.Errorf("could to update user followers count: %v", err)
+	}
+	return nil
+}
+
+// toggleFollowRequest creates or cancels a follow request to a private account,
+// committing the given transaction.
+func (s *Service) toggleFollowRequest(ctx context.Context, tx pgx.Tx, requesterID, targetID int64) (ToggleFollowOutput, error) {
+	var out ToggleFollowOutput
+	query := "DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2"
+	commandTag, err := tx.Exec(ctx, query, requesterID, targetID)
+	if err != nil {
+		return out, fmt.Errorf("could not delete follow request: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		query = "INSERT INTO follow_requests (requester_id, target_id) VALUES ($1, $2)"
+		if _, err = tx.Exec(ctx, query, requesterID, targetID); err != nil {
+			return out, fmt.Errorf("could not insert follow request: %v", err)
+		}
+		out.Requested = true
+	}
+	query = "SELECT followers_count FROM users WHERE id = $1"
+	if err = tx.QueryRow(ctx, query, targetID).Scan(&out.FollowersCount); err != nil {
+		return out, fmt.Errorf("could not query followers count: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return out, fmt.Errorf("could not commit follow request transcation, %v", err)
+	}
+	if out.Requested {
+		go s.NotifyFollowRequest(requesterID, targetID)
+	}
+	return out, nil
+}
+
+// ensureProfileVisible returns ErrPrivateAccount when the user is private and
+// the auth user is neither them nor one of their followers.
+func (s *Service) ensureProfileVisible(ctx context.Context, username string) error {
+	uid, _ := ctx.Value(KeyAuthUserID).(int64)
+	var visible bool
+	query := `SELECT NOT users.is_private OR users.id = $2
+	OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = $2 AND follows.following_id = users.id)
+	FROM users WHERE username = $1`
+	err := s.Db.QueryRow(ctx, query, username, uid).Scan(&visible)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not check profile visibility: %v", err)
+	}
+	if !visible {
+		return ErrPrivateAccount
+	}
+	return nil
+}
+
+// postVisible reports if the author of the post is public, the user, or followed by the user.
+func postVisible(ctx context.Context, q queryRower, uid, postID int64) (bool, error) {
+	var visible bool
+	query := `SELECT NOT users.is_private OR users.id = $1
+	OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = $1 AND follows.following_id = users.id)
+	FROM posts INNER JOIN users ON users.id = posts.user_id WHERE posts.id = $2`
+	err := q.QueryRow(ctx, query, uid, postID).Scan(&visible)
+	if err == pgx.ErrNoRows {
+		return false, ErrPostNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not check post visibility: %v", err)
+	}
+	return visible, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidWebsite = errors.New("website must be an http or https url")
+
+// UpdateProfileInput fields left nil are kept, empty strings clear the field.
+type UpdateProfileInput struct {
+	DisplayName *string `validate:"omitempty,max=50"`
+	Bio         *string `validate:"omitempty,max=160"`
+	Website     *string `validate:"omitempty,max=100"`
+	Location    *string `validate:"omitempty,max=50"`
+}
+
+func (in UpdateProfileInput) Validate() error {
+	return validator.New().Struct(in)
+}
+
+// normalize trims the fields and rewrites the website the way it is stored,
+// the lengths are checked afterwards as escaping can make the website longer.
+func (in UpdateProfileInput) normalize() error {
+	for _, f := range []*string{in.DisplayName, in.Bio, in.Website, in.Location} {
+		if f != nil {
+			*f = strings.TrimSpace(*f)
+		}
+	}
+	if in.Website != nil && *in.Website != "" {
+		u, err := url.Parse(*in.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidWebsite
+		}
+		*in.Website = u.String()
+	}
+	if in.Validate() != nil {
+		return ErrValidations
+	}
+	return nil
+}
+
+// UpdateProfile changes the display name, bio, website and location of the auth user.
+func (s *Service) UpdateProfile(ctx context.Context, in UpdateProfileInput) (UserProfile, error) {
+	var profile UserProfile
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return profile, ErrUnAuthorized
+	}
+
+	if err := in.normalize(); err != nil {
+		return profile, err
+	}
+
+	query, args, err := buildQuery(`UPDATE users SET
+	display_name = {{if .setDisplayName}} NULLIF(@displayName, '') {{else}} display_name {{end}},
+	bio = {{if .setBio}} NULLIF(@bio, '') {{else}} bio {{end}},
+	website = {{if .setWebsite}} NULLIF(@website, '') {{else}} website {{end}},
+	location = {{if .setLocation}} NULLIF(@location, '') {{else}} location {{end}}
+	WHERE id = @uid
+	RETURNING username`, map[string]interface{}{
+		"setDisplayName": in.DisplayName != nil,
+		"displayName":    in.DisplayName,
+		"setBio":         in.Bio != nil,
+		"bio":            in.Bio,
+		"setWebsite":     in.Website != nil,
+		"website":        in.Website,
+		"setLocation":    in.Location != nil,
+		"location":       in.Location,
+		"uid":            uid,
+	})
+	if err != nil {
+		return profile, fmt.Errorf("can not build update profile query, error: %v", err)
+	}
+	var username string
+	err = s.Db.QueryRow(ctx, query, args...).Scan(&username)
+	if err == pgx.ErrNoRows {
+		return profile, ErrUserNotFound
+	}
+	if err != nil {
+		return profile, fmt.Errorf("could not update profile: %v", err)
+	}
+
+	return s.User(ctx, username)
+}
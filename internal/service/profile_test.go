@@ -0,0 +1,63 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestUpdateProfileInputNormalize(t *testing.T) {
+	in := UpdateProfileInput{
+		DisplayName: strPtr("  Jane  "),
+		Bio:         strPtr("\thello\n"),
+		Website:     strPtr(" https://example.com/a b "),
+	}
+	if err := in.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if *in.DisplayName != "Jane" || *in.Bio != "hello" || *in.Website != "https://example.com/a%20b" {
+		t.Fatalf("normalized to %q %q %q", *in.DisplayName, *in.Bio, *in.Website)
+	}
+	if in.Location != nil {
+		t.Fatal("missing field was set")
+	}
+}
+
+func TestUpdateProfileInputClearsFields(t *testing.T) {
+	in := UpdateProfileInput{
+		DisplayName: strPtr(""),
+		Bio:         strPtr("   "),
+		Website:     strPtr(""),
+		Location:    strPtr(" "),
+	}
+	if err := in.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	//empty strings are stored as NULL by UpdateProfile
+	for _, f := range []*string{in.DisplayName, in.Bio, in.Website, in.Location} {
+		if f == nil || *f != "" {
+			t.Fatalf("field not cleared: %v", f)
+		}
+	}
+}
+
+func TestUpdateProfileInputLengths(t *testing.T) {
+	//98 characters that escape past the 100 of the column
+	escaped := UpdateProfileInput{Website: strPtr("https://example.com/" + strings.Repeat("a b", 26))}
+	if err := escaped.normalize(); err != ErrValidations {
+		t.Fatalf("err = %v, want %v", err, ErrValidations)
+	}
+
+	//lengths count characters, not bytes
+	if err := (UpdateProfileInput{DisplayName: strPtr(strings.Repeat("é", 50))}).normalize(); err != nil {
+		t.Fatalf("50 characters rejected: %v", err)
+	}
+	if err := (UpdateProfileInput{DisplayName: strPtr(strings.Repeat("é", 51))}).normalize(); err != ErrValidations {
+		t.Fatalf("err = %v, want %v", err, ErrValidations)
+	}
+
+	if err := (UpdateProfileInput{Website: strPtr("ftp://example.com")}).normalize(); err != ErrInvalidWebsite {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidWebsite)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const MaxRelationshipUsernames = 100
+
+// Relationship model, how the auth user relates to another user
+type Relationship struct {
+	Username   string `json:"username"`
+	Following  bool   `json:"following"`
+	FollowedBy bool   `json:"followed_by"`
+	Requested  bool   `json:"requested"`
+	Blocking   bool   `json:"blocking"`
+	Muting     bool   `json:"muting"`
+}
+
+// Mutuals lists the users the auth user follows who also follow the given user.
+func (s *Service) Mutuals(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	first = normalizePageSize(first)
+	username = strings.TrimSpace(username)
+	after = strings.TrimSpace(after)
+	if err := s.ensureProfileVisible(ctx, username); err != nil {
+		return nil, err
+	}
+	query, args, err := buildQuery(`SELECT users.avatar,users.username,users.display_name,users.bio,users.website,users.location,users.followers_count,users.followings_count
+	,followingback.follower_id IS NOT NULL AS followingback
+	FROM follows AS mine
+	INNER JOIN follows AS theirs ON theirs.follower_id = mine.following_id
+		AND theirs.following_id = (SELECT id FROM users WHERE username = @username)
+	INNER JOIN users ON users.id = mine.following_id
+	LEFT JOIN follows AS followingback ON followingback.following_id = @uid AND followingback.follower_id = users.id
+	WHERE mine.follower_id = @uid
+	{{if .after}} AND users.username > @after {{end}}
+	ORDER BY users.username ASC
+	LIMIT @first
+	`, map[string]interface{}{
+		"username": username,
+		"uid":      uid,
+		"after":    after,
+		"first":    first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not build mutuals query, error: %v", err)
+	}
+	rows, err := s.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query mutuals: %v", err)
+	}
+	defer rows.Close()
+
+	uu := make([]UserProfile, 0, first)
+	for rows.Next() {
+		var profile UserProfile
+		var avatar sql.NullString
+		dest := []interface{}{&avatar, &profile.Username, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Location, &profile.FollowersCount, &profile.FollowingsCount, &profile.FollowingBack}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan mutual profile: %v", err)
+		}
+		profile.Following = true
+		profile.Avatar = s.avatarURLs(avatar)
+		profile.parseBio()
+		uu = append(uu, profile)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate mutual rows: %v", err)
+	}
+	return uu, nil
+}
+
+// Relationships looks up the relationship of the auth user with many users at once,
+// unknown usernames are left out.
+func (s *Service) Relationships(ctx context.Context, usernames []string) ([]Relationship, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	if len(usernames) > MaxRelationshipUsernames {
+		return nil, ErrValidations
+	}
+	query := `SELECT users.username
+	,EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND following_id = users.id) AS following
+	,EXISTS (SELECT 1 FROM follows WHERE follower_id = users.id AND following_id = $1) AS followed_by
+	,EXISTS (SELECT 1 FROM follow_requests WHERE requester_id = $1 AND target_id = users.id) AS requested
+	,EXISTS (SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = users.id) AS blocking
+	,EXISTS (SELECT 1 FROM mutes WHERE muter_id = $1 AND muted_id = users.id AND (expires_at IS NULL OR expires_at > now())) AS muting
+	FROM users
+	WHERE users.username = any($2)
+	ORDER BY users.username`
+	rows, err := s.Db.Query(ctx, query, uid, usernames)
+	if err != nil {
+		return nil, fmt.Errorf("could not query relationships: %v", err)
+	}
+	defer rows.Close()
+
+	rr := make([]Relationship, 0, len(usernames))
+	for rows.Next() {
+		var r Relationship
+		if err = rows.Scan(&r.Username, &r.Following, &r.FollowedBy, &r.Requested, &r.Blocking, &r.Muting); err != nil {
+			return nil, fmt.Errorf("could not scan relationship: %v", err)
+		}
+		rr = append(rr, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate relationship rows: %v", err)
+	}
+	return rr, nil
+}
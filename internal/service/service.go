@@ -1,24 +1,43 @@
 package service
 
 import (
+	"path"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
+	"github.com/paritoshyadav/socialnetwork/internal/service/mailer"
+	"github.com/paritoshyadav/socialnetwork/internal/service/oidc"
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
 )
 
 //logics
 type Service struct {
-	Db                  *pgxpool.Pool
-	Codec               codec.CodecLayer
-	Origin              string
-	timelineITemClients sync.Map
+	Db                   *pgxpool.Pool
+	Codec                codec.CodecLayer
+	Mailer               mailer.MailerLayer
+	Storage              storage.StorageLayer //uploaded files, local disk unless replaced
+	Origin               string
+	PasswordResetURL     string           //page that receives the ?token= of password reset emails
+	Clock                func() time.Time //replaceable for deterministic tests
+	OIDCProviders        map[string]*oidc.Provider
+	LinkSecret           []byte        //signs email verification links
+	RequireVerifiedEmail bool          //blocks posting and commenting until the email is verified
+	PostEditWindow       time.Duration //posts can be edited until this long after they were created
+	timelineITemClients  sync.Map
 }
 
-func New(db *pgxpool.Pool, codec codec.CodecLayer, origin string) *Service {
+func New(db *pgxpool.Pool, codec codec.CodecLayer, mailer mailer.MailerLayer, origin string) *Service {
 	return &Service{
-		Db:     db,
-		Codec:  codec,
-		Origin: origin,
+		Db:               db,
+		Codec:            codec,
+		Mailer:           mailer,
+		Origin:           origin,
+		PasswordResetURL: origin + "/password_reset",
+		Clock:            time.Now,
+		OIDCProviders:    map[string]*oidc.Provider{},
+		Storage:          storage.NewLocal(path.Join("web", "static", "img"), origin+"/img"),
+		PostEditWindow:   DefaultPostEditWindow,
 	}
 }
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
+)
+
+const (
+	RefreshTokenLifetime     = time.Hour * 24 * 14
+	SessionSeenInterval      = time.Minute //last_seen_at is only written once per interval
+	KeyAuthSessionID     key = "auth_session_id"
+	KeyClientInfo        key = "client_info"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+//Session model
+type Session struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// ClientInfo describes the device a session is created from, handlers put it in the context.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// startSession creates a new session for the user and issues its access and refresh tokens.
+func (s *Service) startSession(ctx context.Context, uid int64) (LoginOutput, error) {
+	var lo LoginOutput
+	var err error
+	lo.AuthUser, err = s.UserById(ctx, uid)
+	if err != nil {
+		return lo, err
+	}
+
+	refreshToken, err := gonanoid.New(48)
+	if err != nil {
+		return lo, fmt.Errorf("could not generate refresh token: %v", err)
+	}
+
+	client, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+	var sid int64
+	query := "INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, now() + $5::INTERVAL) RETURNING id"
+	if err = s.Db.QueryRow(ctx, query, uid, hashSecret(refreshToken), client.UserAgent, client.IP, RefreshTokenLifetime).Scan(&sid); err != nil {
+		return lo, fmt.Errorf("could not create session: %v", err)
+	}
+
+	return s.issueTokens(lo, sid, refreshToken)
+}
+
+func (s *Service) issueTokens(lo LoginOutput, sid int64, refreshToken string) (LoginOutput, error) {
+	var err error
+	lo.Token, err = s.Codec.EncodeClaims(codec.Claims{
+		UserID:    lo.AuthUser.ID,
+		SessionID: sid,
+		Scopes:    []string{codec.ScopeRead, codec.ScopeWrite},
+	})
+	if err != nil {
+		return lo, err
+	}
+	lo.Expiration = s.Clock().Add(TokenLifetime)
+	lo.RefreshToken = refreshToken
+	lo.RefreshExpiration = s.Clock().Add(RefreshTokenLifetime)
+	return lo, nil
+}
+
+// RefreshSession rotates the refresh token and issues a new access token.
+// Presenting an already rotated refresh token revokes the whole session as it was likely stolen.
+func (s *Service) RefreshSession(ctx context.Context, refreshToken string) (LoginOutput, error) {
+	var lo LoginOutput
+	newRefreshToken, err := gonanoid.New(48)
+	if err != nil {
+		return lo, fmt.Errorf("could not generate refresh token: %v", err)
+	}
+
+	client, _ := ctx.Value(KeyClientInfo).(ClientInfo)
+	var sid, uid int64
+	query := `UPDATE sessions SET previous_token_hash = refresh_token_hash, refresh_token_hash = $2,
+	user_agent = $3, ip = $4, last_seen_at = now(), expires_at = now() + $5::INTERVAL
+	WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > now()
+	RETURNING id, user_id`
+	err = s.Db.QueryRow(ctx, query, hashSecret(refreshToken), hashSecret(newRefreshToken), client.UserAgent, client.IP, RefreshTokenLifetime).Scan(&sid, &uid)
+	if err == pgx.ErrNoRows {
+		query = "UPDATE sessions SET revoked_at = now() WHERE previous_token_hash = $1 AND revoked_at IS NULL"
+		if _, err = s.Db.Exec(ctx, query, hashSecret(refreshToken)); err != nil {
+			return lo, fmt.Errorf("could not revoke session of reused refresh token: %v", err)
+		}
+		return lo, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return lo, fmt.Errorf("could not rotate refresh token: %v", err)
+	}
+
+	lo.AuthUser, err = s.UserById(ctx, uid)
+	if err != nil {
+		return lo, err
+	}
+
+	return s.issueTokens(lo, sid, newRefreshToken)
+}
+
+// SessionActive reports if the session of an access token is still valid and marks it as seen.
+// It runs on every authenticated request so the write only happens when last_seen_at is stale.
+func (s *Service) SessionActive(ctx context.Context, uid, sid int64) (bool, error) {
+	var stale bool
+	query := "SELECT last_seen_at < now() - $3::INTERVAL FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()"
+	err := s.Db.QueryRow(ctx, query, sid, uid, SessionSeenInterval).Scan(&stale)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not check session: %v", err)
+	}
+	if stale {
+		query = "UPDATE sessions SET last_seen_at = now() WHERE id = $1"
+		if _, err = s.Db.Exec(ctx, query, sid); err != nil {
+			return false, fmt.Errorf("could not mark session as seen: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// Sessions lists the active sessions of the auth user, most recently seen first.
+func (s *Service) Sessions(ctx context.Context) ([]Session, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	current, _ := ctx.Value(KeyAuthSessionID).(int64)
+
+	query := `SELECT id, user_agent, ip, created_at, last_seen_at FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+	ORDER BY last_seen_at DESC`
+	rows, err := s.Db.Query(ctx, query, uid)
+	if err != nil {
+		return nil, fmt.Errorf("could not query sessions: %v", err)
+	}
+	defer rows.Close()
+
+	ss := []Session{}
+	for rows.Next() {
+		var session Session
+		if err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("could not scan session: %v", err)
+		}
+		session.Current = session.ID == current
+		ss = append(ss, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate session rows: %v", err)
+	}
+
+	return ss, nil
+}
+
+// RevokeSession logs out a single session of the auth user.
+func (s *Service) RevokeSession(ctx context.Context, sid int64) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query, sid, uid)
+	if err != nil {
+		return fmt.Errorf("could not revoke session: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessions logs out every session of the auth user, the current one included.
+func (s *Service) RevokeSessions(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	query := "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err := s.Db.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not revoke sessions: %v", err)
+	}
+	return nil
+}
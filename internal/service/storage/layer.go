@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// StorageLayer keeps uploaded files, names are slash separated like "avatars/abc-48.png".
+type StorageLayer interface {
+	Put(ctx context.Context, name string, r io.Reader, contentType string) error
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error //deleting a missing file is not an error
+	URL(name string) string
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores files on disk under dir, every instance of the app needs access to the same directory.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal serves the files of dir from baseURL, "web/static/img" from "http://localhost:8000/img".
+func NewLocal(dir, baseURL string) *Local {
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (l *Local) path(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if clean == "/" || clean != "/"+name {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial file.
+func (l *Local) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("could not create directory for %s: %v", name, err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", name, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+	if err = os.Rename(f.Name(), p); err != nil {
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+	return nil
+}
+
+func (l *Local) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", name, err)
+	}
+	return f, nil
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete %s: %v", name, err)
+	}
+	return nil
+}
+
+func (l *Local) URL(name string) string {
+	return l.baseURL + "/" + name
+}
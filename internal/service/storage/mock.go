@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockS3 is an in memory stand-in for an s3 compatible server to use in tests and development.
+// It checks the signature of every request, plain and signed url ones.
+//
+//	m := storage.NewMockS3("bucket", "key", "secret")
+//	srv := httptest.NewServer(m)
+//	s, _ := storage.NewS3(storage.S3Config{Endpoint: srv.URL, Bucket: "bucket", AccessKey: "key", SecretKey: "secret"})
+type MockS3 struct {
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	mu      sync.Mutex
+	objects map[string]mockObject
+}
+
+type mockObject struct {
+	data        []byte
+	contentType string
+}
+
+func NewMockS3(bucket, accessKey, secretKey string) *MockS3 {
+	return &MockS3{
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		objects:   map[string]mockObject{},
+	}
+}
+
+// Names of the stored objects.
+func (m *MockS3) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.objects))
+	for name := range m.objects {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (m *MockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + m.Bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) || len(r.URL.Path) == len(prefix) {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "IncompleteBody", http.StatusBadRequest)
+		return
+	}
+	if !m.authorized(r, body) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		m.objects[name] = mockObject{data: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		o, ok := m.objects[name]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		if o.contentType != "" {
+			w.Header().Set("Content-Type", o.contentType)
+		}
+		w.Write(o.data)
+	case http.MethodDelete:
+		delete(m.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *MockS3) authorized(r *http.Request, body []byte) bool {
+	q := r.URL.Query()
+	var credential, signedHeaders, sig, amzDate, payloadHash string
+	if q.Get("X-Amz-Signature") != "" {
+		credential = q.Get("X-Amz-Credential")
+		signedHeaders = q.Get("X-Amz-SignedHeaders")
+		sig = q.Get("X-Amz-Signature")
+		amzDate = q.Get("X-Amz-Date")
+		payloadHash = unsignedPayload
+		q.Del("X-Amz-Signature")
+		date, err := time.Parse(amzDateFormat, amzDate)
+		expires, _ := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || time.Since(date) > time.Duration(expires)*time.Second {
+			return false
+		}
+	} else {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+		for _, part := range strings.Split(auth, ", ") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return false
+			}
+			switch kv[0] {
+			case "Credential":
+				credential = kv[1]
+			case "SignedHeaders":
+				signedHeaders = kv[1]
+			case "Signature":
+				sig = kv[1]
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash != hashHex(body) {
+			return false
+		}
+		q = url.Values{}
+	}
+
+	//access key, date, region, service, aws4_request
+	cred := strings.Split(credential, "/")
+	if len(cred) != 5 || cred[0] != m.AccessKey || len(amzDate) < 8 || cred[1] != amzDate[:8] {
+		return false
+	}
+	signed := strings.Split(signedHeaders, ";")
+	headers := map[string]string{}
+	for _, h := range signed {
+		if h == "host" {
+			headers[h] = r.Host
+			continue
+		}
+		headers[h] = r.Header.Get(h)
+	}
+	want := signature(m.SecretKey, cred[2], amzDate, r.Method, r.URL.EscapedPath(), q, headers, signed, payloadHash)
+	return sig == want
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	MaxURLExpiry    = 7 * 24 * time.Hour //longest expiry s3 accepts for signed urls
+)
+
+// S3Config points to a bucket of any s3 compatible server (aws, minio, ...), objects are addressed path style.
+type S3Config struct {
+	Endpoint  string //"https://s3.eu-west-1.amazonaws.com" or "http://127.0.0.1:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string        //serves a public bucket through a cdn, signed urls are used when empty
+	URLExpiry time.Duration //lifetime of signed urls, defaults to MaxURLExpiry
+}
+
+// S3 stores files in a bucket signing every request with AWS signature version 4.
+type S3 struct {
+	S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	u, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3 bucket and credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.URLExpiry <= 0 || cfg.URLExpiry > MaxURLExpiry {
+		cfg.URLExpiry = MaxURLExpiry
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	return &S3{
+		S3Config: cfg,
+		endpoint: u,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.Bucket + "/" + name
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", name, err)
+	}
+	res, err := s.do(ctx, http.MethodPut, name, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not put %s: %s", name, responseMessage(res))
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, name, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, fmt.Errorf("could not get %s: %s", name, responseMessage(res))
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, name, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("could not delete %s: %s", name, responseMessage(res))
+	}
+	return nil
+}
+
+// URL of a public bucket or a signed url valid for URLExpiry.
+// Signed urls are dated back to the start of a seventh of URLExpiry, a day by default, so the
+// same file keeps the same url, and browser caches hit, while it is still valid for most of its expiry.
+func (s *S3) URL(name string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + uriEncode(name, false)
+	}
+	signedAt := s.now().UTC().Truncate(s.URLExpiry / 7)
+	return s.signedURL(name, s.URLExpiry, signedAt)
+}
+
+// SignedURL lets anyone holding it download the file until it expires.
+func (s *S3) SignedURL(name string, expiry time.Duration) string {
+	return s.signedURL(name, expiry, s.now().UTC())
+}
+
+func (s *S3) signedURL(name string, expiry time.Duration, signedAt time.Time) string {
+	amzDate := signedAt.Format(amzDateFormat)
+	u := s.objectURL(name)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.AccessKey+"/"+scope(amzDate, s.Region))
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	sig := signature(s.SecretKey, s.Region, amzDate, http.MethodGet, u.EscapedPath(), q,
+		map[string]string{"host": u.Host}, []string{"host"}, unsignedPayload)
+	q.Set("X-Amz-Signature", sig)
+	u.RawQuery = canonicalQuery(q)
+	return u.String()
+}
+
+func (s *S3) do(ctx context.Context, method, name string, body []byte, contentType string) (*http.Response, error) {
+	u := s.objectURL(name)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create s3 request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	amzDate := s.now().UTC().Format(amzDateFormat)
+	payloadHash := hashHex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{"host": u.Host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	sig := signature(s.SecretKey, s.Region, amzDate, method, u.EscapedPath(), url.Values{}, headers, signed, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope(amzDate, s.Region), strings.Join(signed, ";"), sig))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not %s %s: %v", method, name, err)
+	}
+	return res, nil
+}
+
+func responseMessage(res *http.Response) string {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Sprintf("%s %s", res.Status, strings.TrimSpace(string(b)))
+}
+
+func scope(amzDate, region string) string {
+	return amzDate[:8] + "/" + region + "/s3/aws4_request"
+}
+
+// signature computes the AWS signature version 4 of a request, headers have lowercase names.
+func signature(secret, region, amzDate, method, uri string, query url.Values, headers map[string]string, signed []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(method + "\n")
+	b.WriteString(uri + "\n")
+	b.WriteString(canonicalQuery(query) + "\n")
+	for _, h := range signed {
+		b.WriteString(h + ":" + strings.TrimSpace(headers[h]) + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Join(signed, ";") + "\n")
+	b.WriteString(payloadHash)
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope(amzDate, region) + "\n" + hashHex([]byte(b.String()))
+
+	key := hmacSHA256([]byte("AWS4"+secret), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vv := append([]string(nil), q[k]...)
+		sort.Strings(vv)
+		for _, v := range vv {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters the way s3 expects.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	// suggestionSampleSize caps both hops of the follow graph walk so users
+	// following thousands of accounts stay cheap to rank.
+	suggestionSampleSize = 500
+	// suggestionPopularSize is how many popular accounts are mixed in for
+	// users with little or no follow graph yet.
+	suggestionPopularSize = 50
+)
+
+// Suggestion model, an account the auth user may want to follow
+type Suggestion struct {
+	User
+	FollowersCount int      `json:"followers_count"`
+	MutualsCount   int      `json:"mutuals_count"`
+	FollowedBy     []string `json:"followed_by"`
+	Reason         string   `json:"reason"`
+}
+
+// Suggestions ranks accounts followed by the people the auth user follows,
+// boosted by popularity and recent posts, leaving out followed, requested,
+// blocked and muted accounts.
+func (s *Service) Suggestions(ctx context.Context, first int) ([]Suggestion, error) {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return nil, ErrUnAuthorized
+	}
+	first = normalizePageSize(first)
+
+	//rank and cut the page first, the names in followed_by are only looked up for the returned rows
+	query, args, err := buildQuery(`WITH mine AS (
+		SELECT following_id AS id FROM follows WHERE follower_id = @uid ORDER BY created_at DESC LIMIT @sample
+	), fof AS (
+		SELECT hop.following_id AS id, mine.id AS via FROM mine,
+		LATERAL (SELECT following_id FROM follows WHERE follows.follower_id = mine.id ORDER BY created_at DESC LIMIT @sample) AS hop
+	), candidates AS (
+		SELECT c.id, count(c.via) AS mutuals FROM (
+			SELECT id, via FROM fof
+			UNION ALL
+			(SELECT id, NULL::INT AS via FROM users ORDER BY followers_count DESC LIMIT @popular)
+		) AS c
+		GROUP BY c.id
+	), ranked AS (
+		SELECT users.id, users.username, users.avatar, users.followers_count, candidates.mutuals
+		,candidates.mutuals * 10
+			+ ln(users.followers_count::FLOAT + 1)
+			+ CASE
+				WHEN EXISTS (SELECT 1 FROM posts WHERE posts.user_id = users.id AND posts.created_at > now() - INTERVAL '7 days') THEN 5
+				WHEN EXISTS (SELECT 1 FROM posts WHERE posts.user_id = users.id AND posts.created_at > now() - INTERVAL '30 days') THEN 2
+				ELSE 0
+			END AS score
+		FROM candidates
+		INNER JOIN users ON users.id = candidates.id
+		WHERE users.id != @uid
+		AND NOT EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @uid AND follows.following_id = users.id)
+		AND NOT EXISTS (SELECT 1 FROM follow_requests WHERE follow_requests.requester_id = @uid AND follow_requests.target_id = users.id)
+		AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = users.id) OR (blocks.blocker_id = users.id AND blocks.blocked_id = @uid))
+		AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = users.id
+			AND (mutes.expires_at IS NULL OR mutes.expires_at > now()))
+		ORDER BY score DESC, users.id
+		LIMIT @first
+	)
+	SELECT ranked.username, ranked.avatar, ranked.followers_count, ranked.mutuals
+	,ARRAY(SELECT via.username FROM fof INNER JOIN users AS via ON via.id = fof.via
+		WHERE fof.id = ranked.id ORDER BY via.followers_count DESC, via.username LIMIT 2) AS followed_by
+	FROM ranked
+	ORDER BY ranked.score DESC, ranked.id
+	`, map[string]interface{}{
+		"uid":     uid,
+		"sample":  suggestionSampleSize,
+		"popular": suggestionPopularSize,
+		"first":   first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not build suggestions query, error: %v", err)
+	}
+	rows, err := s.Db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query suggestions: %v", err)
+	}
+	defer rows.Close()
+
+	ss := make([]Suggestion, 0, first)
+	for rows.Next() {
+		var sg Suggestion
+		var avatar sql.NullString
+		if err = rows.Scan(&sg.Username, &avatar, &sg.FollowersCount, &sg.MutualsCount, &sg.FollowedBy); err != nil {
+			return nil, fmt.Errorf("could not scan suggestion: %v", err)
+		}
+		sg.Avatar = s.avatarURLs(avatar)
+		sg.Reason = suggestionReason(sg.FollowedBy, sg.MutualsCount)
+		ss = append(ss, sg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate suggestion rows: %v", err)
+	}
+	return ss, nil
+}
+
+// suggestionReason explains a suggestion, e.g. "Followed by alice, bob and 3 others you know".
+func suggestionReason(followedBy []string, mutuals int) string {
+	if len(followedBy) == 0 {
+		return "Popular on Socially"
+	}
+	others := mutuals - len(followedBy)
+	switch {
+	case others == 1:
+		return fmt.Sprintf("Followed by %s and 1 other you know", strings.Join(followedBy, ", "))
+	case others > 1:
+		return fmt.Sprintf("Followed by %s and %d others you know", strings.Join(followedBy, ", "), others)
+	default:
+		return fmt.Sprintf("Followed by %s you know", strings.Join(followedBy, " and "))
+	}
+}
@@ -8,12 +8,18 @@ import (
 )
 
 type TimelineItem struct {
-	ID     int64 `json:"id"`
-	UserId int64 `json:"-"`
-	PostId int64 `json:"-"`
-	Post   Post  `json:"post"`
+	ID     int64  `json:"id"`
+	UserId int64  `json:"-"`
+	PostId int64  `json:"-"`
+	Post   Post   `json:"post"`
+	Event  string `json:"event,omitempty"` //set on live updates of items already delivered
 }
 
+const (
+	TimelineEventEdit   = "edit"
+	TimelineEventDelete = "delete"
+)
+
 type TimelineItemClient struct {
 	timeline chan TimelineItem
 	userID   int64
@@ -27,7 +33,7 @@ func (s *Service) RetrieveTimelineItems(ctx context.Context, last int, before st
 	if !ok {
 		return items, ErrUnAuthorized
 	}
-	query, args, err := buildQuery(`SELECT timelines.id, posts.id,content, created_at,likes_count,spoiler,nsfw 
+	query, args, err := buildQuery(`SELECT timelines.id, posts.id,content, created_at,updated_at,likes_count,spoiler,nsfw 
 	,users.username As username
 	,users.avatar As avatar_url
 	,posts.user_id = @uid As mine
@@ -37,6 +43,11 @@ func (s *Service) RetrieveTimelineItems(ctx context.Context, last int, before st
 	Inner join users on users.id = posts.user_id		
 	LEFT JOIN likes ON likes.post_id = posts.id AND likes.user_id = @uid	
 	WHERE timelines.user_id = @uid
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = posts.user_id) OR (blocks.blocker_id = posts.user_id AND blocks.blocked_id = @uid))
+	AND NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @uid AND mutes.muted_id = posts.user_id
+		AND (mutes.expires_at IS NULL OR mutes.expires_at > now()))
+	AND (posts.user_id = @uid OR NOT EXISTS (SELECT 1 FROM muted_words WHERE muted_words.user_id = @uid
+		AND (muted_words.expires_at IS NULL OR muted_words.expires_at > now()) AND strpos(lower(posts.content), muted_words.phrase) > 0))
 	{{if .before}}
 	AND timelines.id < @before
 	{{end}}
@@ -61,15 +72,12 @@ func (s *Service) RetrieveTimelineItems(ctx context.Context, last int, before st
 	defer rows.Close()
 	for rows.Next() {
 		var item TimelineItem
-		if err = rows.Scan(&item.ID, &p.ID, &p.Content, &p.CreatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &u.Username, &avatar, &p.IsMe, &p.Liked); err != nil {
+		if err = rows.Scan(&item.ID, &p.ID, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.LikesCount, &p.SpoilerOf, &p.NSFW, &u.Username, &avatar, &p.IsMe, &p.Liked); err != nil {
 			return items, fmt.Errorf("can not scan post, error: %v", err)
 		}
 		item.UserId = uid
 		item.PostId = p.ID
-		if avatar.Valid {
-			url := s.Origin + "/img/avatars" + avatar.String
-			u.AvatarUrl = &url
-		}
+		u.Avatar = s.avatarURLs(avatar)
 		p.User = &u
 		item.Post = p
 		items = append(items, item)
@@ -107,9 +115,21 @@ func (s *Service) SubscribeToTimeline(ctx context.Context) (chan TimelineItem, e
 //broadcast timeline item to all clients
 
 func (s *Service) broadcastTimelineItem(ti TimelineItem) {
+	checked, muted := false, false
 	s.timelineITemClients.Range(func(key, value interface{}) bool {
 		if key.(*TimelineItemClient).userID == ti.UserId {
-			key.(*TimelineItemClient).timeline <- ti
+			//check mutes once, only when the user is actually listening
+			if !checked {
+				var err error
+				muted, err = s.mutedFor(context.Background(), ti.UserId, ti.Post.UserId, ti.Post.Content)
+				if err != nil {
+					log.Printf("can not check timeline item mutes: %v", err)
+				}
+				checked = true
+			}
+			if !muted {
+				key.(*TimelineItemClient).timeline <- ti
+			}
 		}
 
 		return true
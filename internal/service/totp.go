@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	totpIssuer         = "Socially"
+	totpDigits         = 6
+	totpPeriod         = 30 * time.Second
+	totpSkew           = 1 //steps accepted before and after the current one
+	recoveryCodesCount = 10
+	recoveryAlphabet   = "abcdefghjkmnpqrstuvwxyz23456789"
+	MFAPendingLifetime = time.Minute * 5
+	maxMFAAttempts     = 5
+	MFALockout         = time.Minute * 15
+	maxMFAFailures     = 10 //failed codes in a row across every mfa token before the lockout
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two factor authentication already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two factor authentication not enrolled")
+	ErrInvalidMFACode     = errors.New("invalid two factor code")
+	ErrInvalidMFAToken    = errors.New("invalid or expired mfa token")
+	ErrMFALocked          = errors.New("too many invalid two factor codes, try again later")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TOTPEnrollment struct {
+	URI           string   `json:"uri"`
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// totpCode is the RFC 6238 code of the given step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP returns the matched step, steps up to lastStep are rejected so a code can not be replayed.
+func (s *Service) verifyTOTP(secret []byte, code string, lastStep int64) (int64, bool) {
+	current := s.Clock().Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// EnrollTOTP creates a new pending totp secret and recovery codes for the auth user.
+// Two factor authentication is enabled once ConfirmTOTP gets a valid code.
+func (s *Service) EnrollTOTP(ctx context.Context) (TOTPEnrollment, error) {
+	var out TOTPEnrollment
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return out, ErrUnAuthorized
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return out, fmt.Errorf("could not generate totp secret: %v", err)
+	}
+	out.Secret = totpEncoding.EncodeToString(secret)
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return out, fmt.Errorf("can not start the totp enrollment transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	query := "UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled_at IS NULL RETURNING email"
+	err = tx.QueryRow(ctx, query, out.Secret, uid).Scan(&email)
+	if err == pgx.ErrNoRows {
+		return out, ErrTOTPAlreadyEnabled
+	}
+	if err != nil {
+		return out, fmt.Errorf("could not store totp secret: %v", err)
+	}
+
+	query = "DELETE FROM recovery_codes WHERE user_id = $1"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return out, fmt.Errorf("could not delete old recovery codes: %v", err)
+	}
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := gonanoid.Generate(recoveryAlphabet, 10)
+		if err != nil {
+			return out, fmt.Errorf("could not generate recovery code: %v", err)
+		}
+		code = code[:5] + "-" + code[5:]
+		query = "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+		if _, err = tx.Exec(ctx, query, uid, hashSecret(code)); err != nil {
+			return out, fmt.Errorf("could not insert recovery code: %v", err)
+		}
+		out.RecoveryCodes = append(out.RecoveryCodes, code)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return out, fmt.Errorf("can not commit the totp enrollment transcation, error: %v", err)
+	}
+
+	v := url.Values{}
+	v.Set("secret", out.Secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	out.URI = "otpauth://totp/" + url.PathEscape(totpIssuer+":"+email) + "?" + v.Encode()
+
+	return out, nil
+}
+
+// ConfirmTOTP enables two factor authentication once the user proves the authenticator is set up.
+func (s *Service) ConfirmTOTP(ctx context.Context, code string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	var encoded *string
+	var lastStep int64
+	query := "SELECT totp_secret, totp_last_step FROM users WHERE id = $1 AND totp_enabled_at IS NULL"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&encoded, &lastStep)
+	if err == pgx.ErrNoRows {
+		return ErrTOTPAlreadyEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("could not query totp secret: %v", err)
+	}
+	if encoded == nil {
+		return ErrTOTPNotEnrolled
+	}
+	secret, err := totpEncoding.DecodeString(*encoded)
+	if err != nil {
+		return fmt.Errorf("could not decode totp secret: %v", err)
+	}
+	step, ok := s.verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	query = "UPDATE users SET totp_enabled_at = $1, totp_last_step = $2 WHERE id = $3"
+	if _, err = s.Db.Exec(ctx, query, s.Clock().UTC(), step, uid); err != nil {
+		return fmt.Errorf("could not enable totp: %v", err)
+	}
+	return nil
+}
+
+// DisableTOTP turns two factor authentication off, it needs a current code.
+func (s *Service) DisableTOTP(ctx context.Context, code string) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	if err := s.reserveMFAAttempt(ctx, uid); err != nil {
+		return err
+	}
+	if err := s.checkTOTP(ctx, uid, code); err != nil {
+		return err
+	}
+	if err := s.resetMFAFailures(ctx, uid); err != nil {
+		return err
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("can not start the disable totp transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not disable totp: %v", err)
+	}
+	query = "DELETE FROM recovery_codes WHERE user_id = $1"
+	if _, err = tx.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not delete recovery codes: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can not commit the disable totp transcation, error: %v", err)
+	}
+	return nil
+}
+
+// checkTOTP verifies a code of an enabled secret and remembers its step.
+func (s *Service) checkTOTP(ctx context.Context, uid int64, code string) error {
+	var encoded *string
+	var lastStep int64
+	query := "SELECT totp_secret, totp_last_step FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&encoded, &lastStep)
+	if err == pgx.ErrNoRows || (err == nil && encoded == nil) {
+		return ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return fmt.Errorf("could not query totp secret: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(*encoded)
+	if err != nil {
+		return fmt.Errorf("could not decode totp secret: %v", err)
+	}
+	step, ok := s.verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	query = "UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1"
+	commandTag, err := s.Db.Exec(ctx, query, step, uid)
+	if err != nil {
+		return fmt.Errorf("could not update totp step: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// reserveMFAAttempt counts a two factor attempt of the user before the code is checked,
+// so parallel guesses share the limit. maxMFAFailures attempts in a row without a valid
+// code lock the user out for MFALockout, no matter how many mfa tokens are used.
+func (s *Service) reserveMFAAttempt(ctx context.Context, uid int64) error {
+	now := s.Clock().UTC()
+	query := `UPDATE users SET
+	mfa_failures = CASE WHEN mfa_failures + 1 >= $1 THEN 0 ELSE mfa_failures + 1 END,
+	mfa_locked_until = CASE WHEN mfa_failures + 1 >= $1 THEN $2 ELSE NULL END
+	WHERE id = $3 AND (mfa_locked_until IS NULL OR mfa_locked_until <= $4)`
+	commandTag, err := s.Db.Exec(ctx, query, maxMFAFailures, now.Add(MFALockout), uid, now)
+	if err != nil {
+		return fmt.Errorf("could not count mfa attempt: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrMFALocked
+	}
+	return nil
+}
+
+// resetMFAFailures clears the failed attempts once the user gave a valid code.
+func (s *Service) resetMFAFailures(ctx context.Context, uid int64) error {
+	query := "UPDATE users SET mfa_failures = 0, mfa_locked_until = NULL WHERE id = $1"
+	if _, err := s.Db.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not reset mfa failures: %v", err)
+	}
+	return nil
+}
+
+// useRecoveryCode consumes one of the user's recovery codes.
+func (s *Service) useRecoveryCode(ctx context.Context, uid int64, code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	query := "UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query, s.Clock().UTC(), uid, hashSecret(code))
+	if err != nil {
+		return fmt.Errorf("could not use recovery code: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// completeLogin starts a session unless the user has two factor authentication enabled,
+// in which case a short lived mfa token is returned to be exchanged with VerifyMFA.
+func (s *Service) completeLogin(ctx context.Context, uid int64) (LoginOutput, error) {
+	var lo LoginOutput
+	var enabled bool
+	query := "SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&enabled)
+	if err == pgx.ErrNoRows {
+		return lo, ErrUserNotFound
+	}
+	if err != nil {
+		return lo, fmt.Errorf("could not query two factor status: %v", err)
+	}
+	if !enabled {
+		return s.startSession(ctx, uid)
+	}
+
+	token, err := gonanoid.New(32)
+	if err != nil {
+		return lo, fmt.Errorf("could not generate mfa token: %v", err)
+	}
+	expiration := s.Clock().Add(MFAPendingLifetime)
+	query = "INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	if _, err = s.Db.Exec(ctx, query, uid, hashSecret(token), expiration.UTC()); err != nil {
+		return lo, fmt.Errorf("could not insert mfa challenge: %v", err)
+	}
+
+	lo.MFARequired = true
+	lo.MFAToken = token
+	lo.Expiration = expiration
+	return lo, nil
+}
+
+// VerifyMFA exchanges an mfa token plus a totp code, or a recovery code, for a session.
+func (s *Service) VerifyMFA(ctx context.Context, mfaToken, code string, recovery bool) (LoginOutput, error) {
+	var lo LoginOutput
+	var id, uid int64
+	query := "UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2 AND attempts < $3 RETURNING id, user_id"
+	err := s.Db.QueryRow(ctx, query, hashSecret(mfaToken), s.Clock().UTC(), maxMFAAttempts).Scan(&id, &uid)
+	if err == pgx.ErrNoRows {
+		return lo, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return lo, fmt.Errorf("could not query mfa challenge: %v", err)
+	}
+
+	if err = s.reserveMFAAttempt(ctx, uid); err != nil {
+		return lo, err
+	}
+	if recovery {
+		err = s.useRecoveryCode(ctx, uid, code)
+	} else {
+		err = s.checkTOTP(ctx, uid, code)
+	}
+	if err != nil {
+		return lo, err
+	}
+	if err = s.resetMFAFailures(ctx, uid); err != nil {
+		return lo, err
+	}
+
+	query = "UPDATE mfa_challenges SET used_at = $1 WHERE id = $2 AND used_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query, s.Clock().UTC(), id)
+	if err != nil {
+		return lo, fmt.Errorf("could not consume mfa challenge: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return lo, ErrInvalidMFAToken
+	}
+
+	return s.startSession(ctx, uid)
+}
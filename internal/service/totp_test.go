@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func testClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	//the RFC lists 8 digit codes, the last 6 digits are the 6 digit code
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		s := &Service{Clock: testClock(time.Unix(v.unix, 0))}
+		step := v.unix / int64(totpPeriod.Seconds())
+		if code := totpCode(rfc6238Secret, step); code != v.code {
+			t.Errorf("totpCode(%d) = %s, want %s", v.unix, code, v.code)
+		}
+		got, ok := s.verifyTOTP(rfc6238Secret, v.code, 0)
+		if !ok || got != step {
+			t.Errorf("verifyTOTP at %d = %d, %v, want %d, true", v.unix, got, ok, step)
+		}
+	}
+}
+
+func TestTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	s := &Service{Clock: testClock(now)}
+	for offset := int64(-3); offset <= 3; offset++ {
+		_, ok := s.verifyTOTP(rfc6238Secret, totpCode(rfc6238Secret, current+offset), 0)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want {
+			t.Errorf("code %d steps away accepted = %v, want %v", offset, ok, want)
+		}
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	s := &Service{Clock: testClock(now)}
+	code := totpCode(rfc6238Secret, now.Unix()/int64(totpPeriod.Seconds()))
+	step, ok := s.verifyTOTP(rfc6238Secret, code, 0)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+	if _, ok = s.verifyTOTP(rfc6238Secret, code, step); ok {
+		t.Fatal("code accepted twice")
+	}
+
+	//still replayed once the clock moves to the next step within the skew
+	s.Clock = testClock(now.Add(totpPeriod))
+	if _, ok = s.verifyTOTP(rfc6238Secret, code, step); ok {
+		t.Fatal("code accepted twice after the clock moved")
+	}
+	next := totpCode(rfc6238Secret, step+1)
+	if got, ok := s.verifyTOTP(rfc6238Secret, next, step); !ok || got != step+1 {
+		t.Fatalf("next code = %d, %v, want %d, true", got, ok, step+1)
+	}
+
+	//an older code within the skew can not be used after a newer one
+	previous := totpCode(rfc6238Secret, step-1)
+	if _, ok = s.verifyTOTP(rfc6238Secret, previous, step); ok {
+		t.Fatal("older code accepted after a newer one")
+	}
+}
+
+func TestTOTPWrongCode(t *testing.T) {
+	s := &Service{Clock: testClock(time.Unix(1111111111, 0))}
+	for _, code := range []string{"", "000000", "05047", "0504710", "abcdef"} {
+		if _, ok := s.verifyTOTP(rfc6238Secret, code, 0); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+}
@@ -3,17 +3,14 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"os"
-	"path"
+	"log"
+	"strconv"
 	"strings"
 
-	"github.com/disintegration/imaging"
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v4"
 	gonanoid "github.com/matoous/go-nanoid/v2"
@@ -28,34 +25,52 @@ var (
 	ErrInvalidUsername        = errors.New("invalid email address")
 	ErrValidations            = errors.New("validations Fail")
 	ErrUnSpportedAvatarFormat = errors.New("wrong Image format")
+	ErrInvalidCursor          = errors.New("invalid cursor")
 )
 
-var (
-	avatarsDir = path.Join("web", "static", "img", "avatars")
-)
+const avatarsDir = "avatars" //folder of the avatars in the storage
 
 const MaxAvatarBytes = 5 << 20 //5MB
 
 //User model
 type User struct {
-	ID        int64   `json:"id,omitempty" validate:"required"`
-	Username  string  `json:"username,omitempty" validate:"required,email"`
-	AvatarUrl *string `json:"avatarUrl"` //using pointer as it can be null
+	ID       int64      `json:"id,omitempty" validate:"required"`
+	Username string     `json:"username,omitempty" validate:"required,email"`
+	Avatar   AvatarURLs `json:"avatar"` //nil when the user has no avatar
 }
 
 type ToggleFollowOutput struct {
 	Following      bool `json:"following"`
+	Requested      bool `json:"requested"`
 	FollowersCount int  `json:"followers_count"`
 }
 
 type UserProfile struct {
 	User
-	Email           string `json:"email,omitempty"`
-	FollowersCount  int    `json:"followers_count"`
-	FollowingsCount int    `json:"following_count"`
-	Me              bool   `json:"me,omitempty"`
-	Following       bool   `json:"following"` //TODO: instead of bool get list nfollowing user and follower user and check if user id contain in the list
-	FollowingBack   bool   `json:"following_back"`
+	Email           string   `json:"email,omitempty"`
+	DisplayName     *string  `json:"display_name"`
+	Bio             *string  `json:"bio"`
+	BioMentions     []string `json:"bio_mentions,omitempty"`
+	BioLinks        []string `json:"bio_links,omitempty"`
+	Website         *string  `json:"website"`
+	Location        *string  `json:"location"`
+	BannerURL       *string  `json:"banner_url"`
+	IsPrivate       bool     `json:"is_private"`
+	FollowersCount  int      `json:"followers_count"`
+	FollowingsCount int      `json:"following_count"`
+	Me              bool     `json:"me,omitempty"`
+	Following       bool     `json:"following"` //TODO: instead of bool get list nfollowing user and follower user and check if user id contain in the list
+	FollowingBack   bool     `json:"following_back"`
+	Cursor          string   `json:"cursor,omitempty"`
+}
+
+// parseBio collects the mentions and links of the bio so clients can render them.
+func (p *UserProfile) parseBio() {
+	if p.Bio == nil {
+		return
+	}
+	p.BioMentions = collectMentions(*p.Bio)
+	p.BioLinks = collectLinks(*p.Bio)
 }
 
 func (u User) Validate() error {
@@ -64,25 +79,42 @@ func (u User) Validate() error {
 
 }
 
-func (s *Service) CreateUser(ctx context.Context, email string, username string) error {
-	query := "INSERT INTO users (email, username) VALUES ($1,$2)"
-	commandTag, err := s.Db.Exec(ctx, query, email, username)
+// CreateUser registers a new user, password is optional as users can always login with a magic link.
+func (s *Service) CreateUser(ctx context.Context, email string, username string, password *string) error {
+	reserved, err := s.usernameReserved(ctx, username)
+	if err != nil {
+		return err
+	}
+	if reserved {
+		return ErrUsernameTaken
+	}
+	var passwordHash *string
+	if password != nil {
+		encoded, err := hashPassword(*password)
+		if err != nil {
+			return err
+		}
+		passwordHash = &encoded
+	}
+	var uid int64
+	query := "INSERT INTO users (email, username, password_hash, verification_sent_at) VALUES ($1,$2,$3,now()) RETURNING id"
+	err = s.Db.QueryRow(ctx, query, email, username, passwordHash).Scan(&uid)
 
-	fmt.Printf("users")
 	ok := isUnquieViolation(err)
-	fmt.Printf("is unique %v %v", err, ok)
 	if ok && strings.Contains(err.Error(), "email") {
 		return ErrEmailTaken
 	}
 	if ok && strings.Contains(err.Error(), "username") {
 		return ErrUsernameTaken
 	}
-	if commandTag.RowsAffected() != 1 {
+	if err == pgx.ErrNoRows {
 		return ErrNoRowAffected
 	}
 	if err != nil {
 		return err
 	}
+
+	s.emailCreated(ctx, uid, email)
 	return nil
 
 }
@@ -102,10 +134,7 @@ func (s *Service) UserById(ctx context.Context, uid int64) (User, error) {
 		return u, fmt.Errorf("unable to query: %v", err)
 	}
 	u.ID = uid
-	if avatar.Valid {
-		url := s.Origin + "img/avatars" + avatar.String
-		u.AvatarUrl = &url
-	}
+	u.Avatar = s.avatarURLs(avatar)
 	return u, nil
 
 }
@@ -121,9 +150,10 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 	if err != nil {
 		return out, fmt.Errorf("can not start the transcation, error: %v", err)
 	}
-	query := "select id from users where username = $1"
+	query := "select id, is_private from users where username = $1"
 	var followingID int64
-	err = tx.QueryRow(ctx, query, username).Scan(&followingID)
+	var private bool
+	err = tx.QueryRow(ctx, query, username).Scan(&followingID, &private)
 	if err == pgx.ErrNoRows {
 		return out, ErrUserNotFound
 	}
@@ -134,10 +164,20 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 	if userId == followingID {
 		return out, ErrInvalidFollow
 	}
+	blocked, err := blockedBetween(ctx, tx, userId, followingID)
+	if err != nil {
+		return out, err
+	}
+	if blocked {
+		return out, ErrUserBlocked
+	}
 	query = "select exists (select 1 from follows where follower_id = $1 and following_id = $2)"
 	if err = tx.QueryRow(ctx, query, userId, followingID).Scan(&out.Following); err != nil {
 		return out, fmt.Errorf("could not query select existance of following user: %v", err)
 	}
+	if !out.Following && private {
+		return s.toggleFollowRequest(ctx, tx, userId, followingID)
+	}
 	fmt.Println(out)
 	if out.Following {
 		query = "DELETE FROM follows where follower_id = $1 and following_id = $2"
@@ -186,9 +226,10 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
 
 	var profile UserProfile
 	userID, auth := ctx.Value(KeyAuthUserID).(int64)
-	query := "SELECT id,email,followers_count,followings_count "
+	var avatar, banner sql.NullString
+	query := "SELECT id,email,avatar,banner,display_name,bio,website,location,is_private,followers_count,followings_count "
 	args := []interface{}{username}
-	dest := []interface{}{&profile.ID, &profile.Email, &profile.FollowersCount, &profile.FollowingsCount}
+	dest := []interface{}{&profile.ID, &profile.Email, &avatar, &banner, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Location, &profile.IsPrivate, &profile.FollowersCount, &profile.FollowingsCount}
 	if auth {
 		query += ","
 		query += "following.following_id IS NOT NULL AS following,"
@@ -220,44 +261,84 @@ func (s *Service) User(ctx context.Context, username string) (UserProfile, error
 
 	}
 	profile.Username = username
+	profile.Avatar = s.avatarURLs(avatar)
+	profile.BannerURL = s.bannerURL(banner)
+	profile.parseBio()
 
 	return profile, nil
 }
 
+// Users searches users by username, display name and bio, ranked by trigram
+// similarity with boosts for prefix matches and for people the auth user follows.
+// after is the opaque cursor of the last profile of the previous page.
 func (s *Service) Users(ctx context.Context, search string, first int, after string) ([]UserProfile, error) {
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 	first = normalizePageSize(first)
 	search = strings.TrimSpace(search)
 	after = strings.TrimSpace(after)
-	query, args, err := buildQuery(`SELECT id,email,avatar,username,followers_count,followings_count
-	{{if .auth}}
-	,following.following_id IS NOT NULL AS following
-	,followingback.follower_id IS NOT NULL AS followingback
-	{{end}} 
-	FROM users 
-	{{if .auth}}
-	LEFT JOIN follows AS following ON following.follower_id = @uid AND following.following_id =users.id
-	LEFT JOIN follows AS followingback ON followingback.following_id =users.id AND followingback.follower_id = @uid
-	{{end}}	
-	{{if or .search .after}}WHERE{{end}}
-	{{if .search}}
-	username ILIKE '%' || @search || '%'
+	var cursorRank float64
+	var cursorID int64
+	if after != "" {
+		var err error
+		if cursorRank, cursorID, err = decodeSearchCursor(after); err != nil {
+			return nil, err
+		}
+	}
+	pattern := likeEscaper.Replace(search)
+	query, args, err := buildQuery(`SELECT * FROM (
+		SELECT users.id,email,avatar,username,display_name,bio,website,location,followers_count,followings_count
+		{{if .auth}}
+		,following.following_id IS NOT NULL AS following
+		,followingback.follower_id IS NOT NULL AS followingback
+		{{end}}
+		,(0
+		{{if .search}}
+		+ greatest(similarity(users.username, @search), similarity(coalesce(users.display_name, ''), @search))
+		+ similarity(coalesce(users.bio, ''), @search) * 0.3
+		+ CASE
+			WHEN lower(users.username) = lower(@search) THEN 2
+			WHEN users.username ILIKE @prefix THEN 1
+			WHEN users.display_name ILIKE @prefix THEN 0.5
+			ELSE 0
+		END
+		{{end}}
+		{{if .auth}}
+		+ CASE WHEN following.following_id IS NOT NULL THEN 1 ELSE 0 END
+		{{end}}
+		)::FLOAT AS rank
+		FROM users
+		{{if .auth}}
+		LEFT JOIN follows AS following ON following.follower_id = @uid AND following.following_id =users.id
+		LEFT JOIN follows AS followingback ON followingback.following_id =users.id AND followingback.follower_id = @uid
+		{{end}}
+		WHERE TRUE
+		{{if .search}}
+		AND (users.username % @search OR users.display_name % @search
+			OR users.username ILIKE @prefix OR users.display_name ILIKE @prefix OR users.bio ILIKE @contains)
+		{{end}}
+		{{if .auth}}
+		AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id = users.id) OR (blocks.blocker_id = users.id AND blocks.blocked_id = @uid))
+		{{end}}
+	) AS results
+	{{if .hasCursor}}
+	WHERE rank < @cursorRank OR (rank = @cursorRank AND id > @cursorID)
 	{{end}}
-	{{if and .search .after}} AND {{end}}
-	{{if .after}} username > @after {{end}}	
-	ORDER BY username ASC
+	ORDER BY rank DESC, id ASC
 	LIMIT @first
 	`, map[string]interface{}{
-		"auth":   auth,
-		"search": search,
-		"uid":    uid,
-		"after":  after,
-		"first":  first,
+		"auth":       auth,
+		"search":     search,
+		"prefix":     pattern + "%",
+		"contains":   "%" + pattern + "%",
+		"uid":        uid,
+		"hasCursor":  after != "",
+		"cursorRank": cursorRank,
+		"cursorID":   cursorID,
+		"first":      first,
 	})
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(query)
 	rows, err := s.Db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -268,14 +349,17 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
 
 	for rows.Next() {
 		var profile UserProfile
-		dest := []interface{}{&profile.ID, &profile.Email, &avatar, &profile.Username, &profile.FollowersCount, &profile.FollowingsCount}
+		var rank float64
+		dest := []interface{}{&profile.ID, &profile.Email, &avatar, &profile.Username, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Location, &profile.FollowersCount, &profile.FollowingsCount}
 
 		if auth {
 			dest = append(dest, &profile.Following, &profile.FollowingBack)
 		}
+		dest = append(dest, &rank)
 		if err = rows.Scan(dest...); err != nil {
 			return nil, fmt.Errorf("could not scan user profile: %v", err)
 		}
+		profile.Cursor = encodeSearchCursor(rank, profile.ID)
 
 		profile.Me = auth && uid == profile.ID
 		if !profile.Me {
@@ -285,11 +369,9 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
 
 		}
 
-		if avatar.Valid {
-			url := s.Origin + "/img/avatars" + avatar.String
-			profile.AvatarUrl = &url
-		}
+		profile.Avatar = s.avatarURLs(avatar)
 
+		profile.parseBio()
 		uu = append(uu, profile)
 
 	}
@@ -301,12 +383,43 @@ func (s *Service) Users(ctx context.Context, search string, first int, after str
 	return uu, nil
 }
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// encodeSearchCursor hides the rank and id a search page ended at.
+func encodeSearchCursor(rank float64, id int64) string {
+	raw := strconv.FormatFloat(rank, 'g', -1, 64) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(cursor string) (float64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, ErrInvalidCursor
+	}
+	rank, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return rank, id, nil
+}
+
 func (s *Service) UserFollowers(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
 	uid, auth := ctx.Value(KeyAuthUserID).(int64)
 	first = normalizePageSize(first)
 	username = strings.TrimSpace(username)
 	after = strings.TrimSpace(after)
-	query, args, err := buildQuery(`SELECT id,email,avatar,username,followers_count,followings_count
+	if err := s.ensureProfileVisible(ctx, username); err != nil {
+		return nil, err
+	}
+	query, args, err := buildQuery(`SELECT id,email,avatar,username,display_name,bio,website,location,followers_count,followings_count
 	{{if .auth}}
 	,following.following_id IS NOT NULL AS following
 	,followingback.follower_id IS NOT NULL AS followingback
@@ -319,6 +432,10 @@ func (s *Service) UserFollowers(ctx context.Context, username string, first int,
 	{{end}}	
 	WHERE follows.following_id = (SELECT id From users where username = @username)
 	{{if .after}} AND username > @after {{end}}	
+	{{if .auth}}
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id IN (users.id, follows.following_id))
+		OR (blocks.blocked_id = @uid AND blocks.blocker_id IN (users.id, follows.following_id)))
+	{{end}}
 	ORDER BY username ASC
 	LIMIT @first
 	`, map[string]interface{}{
@@ -342,7 +459,7 @@ func (s *Service) UserFollowers(ctx context.Context, username string, first int,
 
 	for rows.Next() {
 		var profile UserProfile
-		dest := []interface{}{&profile.ID, &profile.Email, &avatar, &profile.Username, &profile.FollowersCount, &profile.FollowingsCount}
+		dest := []interface{}{&profile.ID, &profile.Email, &avatar, &profile.Username, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Location, &profile.FollowersCount, &profile.FollowingsCount}
 
 		if auth {
 			dest = append(dest, &profile.Following, &profile.FollowingBack)
@@ -358,11 +475,9 @@ func (s *Service) UserFollowers(ctx context.Context, username string, first int,
 			profile.Me = false
 
 		}
-		if avatar.Valid {
-			url := s.Origin + "img/avatars" + avatar.String
-			profile.AvatarUrl = &url
-		}
+		profile.Avatar = s.avatarURLs(avatar)
 
+		profile.parseBio()
 		uu = append(uu, profile)
 
 	}
@@ -379,7 +494,10 @@ func (s *Service) UserFollowings(ctx context.Context, username string, first int
 	first = normalizePageSize(first)
 	username = strings.TrimSpace(username)
 	after = strings.TrimSpace(after)
-	query, args, err := buildQuery(`SELECT id,email,username,followers_count,followings_count
+	if err := s.ensureProfileVisible(ctx, username); err != nil {
+		return nil, err
+	}
+	query, args, err := buildQuery(`SELECT id,email,username,display_name,bio,website,location,followers_count,followings_count
 	{{if .auth}}
 	,following.following_id IS NOT NULL AS following
 	,followingback.follower_id IS NOT NULL AS followingback
@@ -392,6 +510,10 @@ func (s *Service) UserFollowings(ctx context.Context, username string, first int
 	{{end}}	
 	WHERE follows.follower_id = (SELECT id From users where username = @username)
 	{{if .after}} AND username > @after {{end}}	
+	{{if .auth}}
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @uid AND blocks.blocked_id IN (users.id, follows.follower_id))
+		OR (blocks.blocked_id = @uid AND blocks.blocker_id IN (users.id, follows.follower_id)))
+	{{end}}
 	ORDER BY username ASC
 	LIMIT @first
 	`, map[string]interface{}{
@@ -415,7 +537,7 @@ func (s *Service) UserFollowings(ctx context.Context, username string, first int
 
 	for rows.Next() {
 		var profile UserProfile
-		dest := []interface{}{&profile.ID, &profile.Email, &profile.Username, &profile.FollowersCount, &profile.FollowingsCount}
+		dest := []interface{}{&profile.ID, &profile.Email, &profile.Username, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Location, &profile.FollowersCount, &profile.FollowingsCount}
 
 		if auth {
 			dest = append(dest, &profile.Following, &profile.FollowingBack)
@@ -432,6 +554,7 @@ func (s *Service) UserFollowings(ctx context.Context, username string, first int
 
 		}
 
+		profile.parseBio()
 		uu = append(uu, profile)
 
 	}
@@ -443,58 +566,40 @@ func (s *Service) UserFollowings(ctx context.Context, username string, first int
 	return uu, nil
 }
 
-func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (string, error) {
+// UpdateAvatar stores every size of the uploaded image in its original format and in webp.
+func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (AvatarURLs, error) {
 	userId, ok := ctx.Value(KeyAuthUserID).(int64)
 	if !ok {
-		return "", ErrUnAuthorized
+		return nil, ErrUnAuthorized
 	}
-	r = io.LimitReader(r, MaxAvatarBytes)
-	img, format, err := image.Decode(r)
+	img, format, err := decodeImage(r, MaxAvatarBytes)
 	if err != nil {
-		return "", fmt.Errorf("could not read the image: %v", err)
-	}
-	if format != "png" && format != "jpeg" {
-		return "", ErrUnSpportedAvatarFormat
+		return nil, err
 	}
-	avatar, err := gonanoid.New()
+	id, err := gonanoid.New()
 	if err != nil {
-		return "", fmt.Errorf("could not generate avatar filename: %v", err)
-	}
-	if format == "png" {
-		avatar += ".png"
+		return nil, fmt.Errorf("could not generate avatar filename: %v", err)
 	}
-	if format == "jpeg" {
-		avatar += ".jpeg"
+	avatar := id + "." + format
 
+	if err = s.writeAvatarSizes(ctx, avatar, img, format); err != nil {
+		return nil, err
 	}
-	avatarPath := path.Join(avatarsDir, avatar)
-	f, err := os.Create(avatarPath)
-	defer func() {
-		err = f.Close() //TODO: handling this error better later
-	}()
-	img = imaging.Fill(img, 400, 400, imaging.Center, imaging.CatmullRom)
-
-	if format == "png" {
-		err = png.Encode(f, img)
-	}
-	if format == "jpeg" {
-		err = jpeg.Encode(f, img, nil)
 
-	}
-	if err != nil {
-		return "", fmt.Errorf("could not encode avatar: %v", err)
-	}
 	var oldAvatar sql.NullString
 	query := `UPDATE users SET avatar = $1 WHERE id = $2 
 	RETURNING (SELECT avatar FROM users WHERE id = $2) AS old_avatar`
 	if err = s.Db.QueryRow(ctx, query, avatar, userId).Scan(&oldAvatar); err != nil {
-		defer os.Remove(avatarPath)
-		return "", fmt.Errorf("could not Update avatar: %v", err)
+		s.removeAvatarFiles(ctx, avatar)
+		return nil, fmt.Errorf("could not Update avatar: %v", err)
 	}
 
 	if oldAvatar.Valid {
-		defer os.Remove(path.Join(avatarsDir, oldAvatar.String))
+		//superseded sizes are deleted once the new avatar is saved
+		if err = s.removeAvatarFiles(ctx, oldAvatar.String); err != nil {
+			log.Printf("could not remove old avatar: %v", err)
+		}
 	}
 
-	return s.Origin + "/img/avatars" + avatar, nil
+	return s.avatarURLs(sql.NullString{String: avatar, Valid: true}), nil
 }
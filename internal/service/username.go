@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// UsernameChangeCooldown is the minimum time between two renames of the same user.
+	UsernameChangeCooldown = time.Hour * 24 * 30
+	// UsernameRedirectLifetime is how long an old username keeps resolving to its owner,
+	// nobody else can claim it in the meantime.
+	UsernameRedirectLifetime = time.Hour * 24 * 90
+)
+
+var (
+	ErrUsernameUnchanged      = errors.New("username is the same as the current one")
+	ErrUsernameChangeCooldown = errors.New("username was changed too recently")
+)
+
+// ChangeUsername renames the auth user. The old username keeps pointing to the
+// user for UsernameRedirectLifetime so links and mentions do not break.
+func (s *Service) ChangeUsername(ctx context.Context, username string) (UserProfile, error) {
+	var profile UserProfile
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return profile, ErrUnAuthorized
+	}
+
+	tx, err := s.Db.Begin(ctx)
+	if err != nil {
+		return profile, fmt.Errorf("can not start the change username transcation, error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	var changedAt *time.Time
+	query := "SELECT username, username_changed_at FROM users WHERE id = $1 FOR UPDATE"
+	err = tx.QueryRow(ctx, query, uid).Scan(&current, &changedAt)
+	if err == pgx.ErrNoRows {
+		return profile, ErrUserNotFound
+	}
+	if err != nil {
+		return profile, fmt.Errorf("could not query the user: %v", err)
+	}
+	if current == username {
+		return profile, ErrUsernameUnchanged
+	}
+	now := s.Clock().UTC()
+	if changedAt != nil && changedAt.Add(UsernameChangeCooldown).After(now) {
+		return profile, ErrUsernameChangeCooldown
+	}
+
+	var reserved bool
+	query = "SELECT EXISTS (SELECT 1 FROM username_history WHERE username = $1 AND user_id != $2 AND expires_at > $3)"
+	if err = tx.QueryRow(ctx, query, username, uid, now).Scan(&reserved); err != nil {
+		return profile, fmt.Errorf("could not check username history: %v", err)
+	}
+	if reserved {
+		return profile, ErrUsernameTaken
+	}
+	//taking back an own old name, or one whose grace period is over
+	query = "DELETE FROM username_history WHERE username = $1"
+	if _, err = tx.Exec(ctx, query, username); err != nil {
+		return profile, fmt.Errorf("could not release username: %v", err)
+	}
+
+	query = "UPDATE users SET username = $1, username_changed_at = $2 WHERE id = $3"
+	_, err = tx.Exec(ctx, query, username, now, uid)
+	if isUnquieViolation(err) {
+		return profile, ErrUsernameTaken
+	}
+	if err != nil {
+		return profile, fmt.Errorf("could not update username: %v", err)
+	}
+
+	query = `INSERT INTO username_history (username, user_id, changed_at, expires_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (username) DO UPDATE SET user_id = excluded.user_id, changed_at = excluded.changed_at, expires_at = excluded.expires_at`
+	if _, err = tx.Exec(ctx, query, current, uid, now, now.Add(UsernameRedirectLifetime)); err != nil {
+		return profile, fmt.Errorf("could not insert username history: %v", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return profile, fmt.Errorf("can not commit the change username transcation, error: %v", err)
+	}
+
+	return s.User(ctx, username)
+}
+
+// RenamedUsername returns the current username of the user who recently went by the given one.
+func (s *Service) RenamedUsername(ctx context.Context, old string) (string, error) {
+	var username string
+	query := `SELECT users.username FROM username_history
+	INNER JOIN users ON users.id = username_history.user_id
+	WHERE username_history.username = $1 AND username_history.expires_at > $2`
+	err := s.Db.QueryRow(ctx, query, old, s.Clock().UTC()).Scan(&username)
+	if err == pgx.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not query username history: %v", err)
+	}
+	return username, nil
+}
+
+// usernameReserved reports if the username is still held by a recent rename.
+func (s *Service) usernameReserved(ctx context.Context, username string) (bool, error) {
+	var reserved bool
+	query := "SELECT EXISTS (SELECT 1 FROM username_history WHERE username = $1 AND expires_at > $2)"
+	if err := s.Db.QueryRow(ctx, query, username, s.Clock().UTC()).Scan(&reserved); err != nil {
+		return false, fmt.Errorf("could not check username history: %v", err)
+	}
+	return reserved, nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"fmt"
+	"net/url"
 	"strings"
 	"text/template"
 
@@ -99,3 +100,23 @@ func collectMentions(s string) []string {
 	}
 	return u
 }
+
+func collectLinks(s string) []string {
+	check := map[string]struct{}{}
+	links := []string{}
+	for _, w := range strings.Fields(s) {
+		w = strings.TrimRight(w, ".,;:!?)")
+		if !strings.HasPrefix(w, "http://") && !strings.HasPrefix(w, "https://") {
+			continue
+		}
+		u, err := url.Parse(w)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if _, ok := check[u.String()]; !ok {
+			check[u.String()] = struct{}{}
+			links = append(links, u.String())
+		}
+	}
+	return links
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/paritoshyadav/socialnetwork/internal/service/mailer"
+)
+
+const (
+	VerificationLinkLifetime = time.Hour * 48
+	VerificationResendDelay  = time.Minute * 2
+)
+
+var (
+	ErrInvalidVerificationLink = errors.New("invalid or expired verification link")
+	ErrEmailAlreadyVerified    = errors.New("email already verified")
+	ErrVerificationThrottled   = errors.New("verification email sent recently, try again later")
+	ErrEmailNotVerified        = errors.New("verify your email first")
+)
+
+// verificationSignature signs the user id, the email and the expiry so changing the email invalidates old links.
+func (s *Service) verificationSignature(uid int64, email string, expires int64) string {
+	mac := hmac.New(sha256.New, s.LinkSecret)
+	fmt.Fprintf(mac, "%d:%s:%d", uid, email, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) sendVerificationEmail(ctx context.Context, uid int64, email string) error {
+	expires := s.Clock().Add(VerificationLinkLifetime).Unix()
+	v := url.Values{}
+	v.Set("uid", strconv.FormatInt(uid, 10))
+	v.Set("expires", strconv.FormatInt(expires, 10))
+	v.Set("signature", s.verificationSignature(uid, email, expires))
+	link := s.Origin + "/verify_email?" + v.Encode()
+
+	err := s.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Socially email",
+		Body:    fmt.Sprintf("Welcome to Socially, confirm your email address with the link below.\n\n%s\n", link),
+	})
+	if err != nil {
+		return fmt.Errorf("could not send verification email: %v", err)
+	}
+	return nil
+}
+
+// emailCreated sends the first verification email of a new user like ResendVerification does,
+// a failure is only logged since the account exists and the user can ask for another email.
+func (s *Service) emailCreated(ctx context.Context, uid int64, email string) {
+	if err := s.sendVerificationEmail(ctx, uid, email); err != nil {
+		log.Println(err)
+	}
+}
+
+// BackfillVerifiedEmails marks the users created before emails were verified as verified,
+// they never got a verification email so RequireVerifiedEmail would lock them out.
+func (s *Service) BackfillVerifiedEmails(ctx context.Context) (int64, error) {
+	query := "UPDATE users SET verified_at = now() WHERE verified_at IS NULL AND verification_sent_at IS NULL"
+	commandTag, err := s.Db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("could not backfill verified emails: %v", err)
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// VerifyEmail checks a signed verification link and marks the email verified.
+func (s *Service) VerifyEmail(ctx context.Context, uid, expires int64, signature string) error {
+	if s.Clock().Unix() > expires {
+		return ErrInvalidVerificationLink
+	}
+	var email string
+	query := "SELECT email FROM users WHERE id = $1"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&email)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidVerificationLink
+	}
+	if err != nil {
+		return fmt.Errorf("could not query the user: %v", err)
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.verificationSignature(uid, email, expires))) {
+		return ErrInvalidVerificationLink
+	}
+
+	query = "UPDATE users SET verified_at = now() WHERE id = $1 AND verified_at IS NULL"
+	if _, err = s.Db.Exec(ctx, query, uid); err != nil {
+		return fmt.Errorf("could not verify email: %v", err)
+	}
+	return nil
+}
+
+// ResendVerification emails a new verification link, at most once per VerificationResendDelay.
+func (s *Service) ResendVerification(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserID).(int64)
+	if !ok {
+		return ErrUnAuthorized
+	}
+	var email string
+	query := `UPDATE users SET verification_sent_at = now()
+	WHERE id = $1 AND verified_at IS NULL AND (verification_sent_at IS NULL OR verification_sent_at < now() - $2::INTERVAL)
+	RETURNING email`
+	err := s.Db.QueryRow(ctx, query, uid, VerificationResendDelay).Scan(&email)
+	if err == pgx.ErrNoRows {
+		var verified bool
+		query = "SELECT verified_at IS NOT NULL FROM users WHERE id = $1"
+		err = s.Db.QueryRow(ctx, query, uid).Scan(&verified)
+		if err == pgx.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("could not query the user: %v", err)
+		}
+		if verified {
+			return ErrEmailAlreadyVerified
+		}
+		return ErrVerificationThrottled
+	}
+	if err != nil {
+		return fmt.Errorf("could not update verification sent time: %v", err)
+	}
+
+	return s.sendVerificationEmail(ctx, uid, email)
+}
+
+// ensureVerified applies the RequireVerifiedEmail policy before creating content.
+func (s *Service) ensureVerified(ctx context.Context, uid int64) error {
+	if !s.RequireVerifiedEmail {
+		return nil
+	}
+	var verified bool
+	query := "SELECT verified_at IS NOT NULL FROM users WHERE id = $1"
+	err := s.Db.QueryRow(ctx, query, uid).Scan(&verified)
+	if err == pgx.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not query email verification: %v", err)
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package webp
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+const (
+	numLiterals     = 256
+	numLengthCodes  = 24
+	numDistanceCode = 40
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// order in which the lengths of the code length code are written.
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) bits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) code(c prefixCode, symbol int) {
+	w.bits(c.codes[symbol], c.lengths[symbol])
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical huffman code, the codes are bit reversed to be written least significant bit first.
+type prefixCode struct {
+	lengths []uint
+	codes   []uint32
+}
+
+func newPrefixCode(counts []int, maxLength int) prefixCode {
+	lengths := codeLengths(counts, maxLength)
+
+	var lengthCount [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		lengthCount[l]++
+	}
+	lengthCount[0] = 0
+	var next [maxCodeLength + 2]uint32
+	for l := 1; l <= maxCodeLength; l++ {
+		next[l+1] = (next[l] + lengthCount[l]) << 1
+	}
+
+	c := prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := next[l]
+		next[l]++
+		var reversed uint32
+		for i := uint(0); i < l; i++ {
+			reversed = reversed<<1 | code>>i&1
+		}
+		c.codes[symbol] = reversed
+	}
+	return c
+}
+
+// codeLengths of a huffman code for the symbol counts, no longer than maxLength.
+// At least two symbols get a code as decoders expect a tree with two leafs.
+func codeLengths(counts []int, maxLength int) []uint {
+	counts = append([]int(nil), counts...)
+	used := 0
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	for i := 0; used < 2 && i < len(counts); i++ {
+		if counts[i] == 0 {
+			counts[i] = 1
+			used++
+		}
+	}
+
+	for {
+		lengths := make([]uint, len(counts))
+		h := &nodeHeap{}
+		for symbol, c := range counts {
+			if c > 0 {
+				*h = append(*h, &node{count: c, symbol: symbol})
+			}
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(h).(*node), heap.Pop(h).(*node)
+			heap.Push(h, &node{count: a.count + b.count, symbol: -1, left: a, right: b})
+		}
+		longest := setDepth((*h)[0], 0, lengths)
+		if longest <= uint(maxLength) {
+			return lengths
+		}
+		//flatten the distribution until the tree fits, single counts give a balanced tree
+		for i, c := range counts {
+			if c > 0 {
+				counts[i] = (c + 1) / 2
+			}
+		}
+	}
+}
+
+type node struct {
+	count       int
+	symbol      int
+	left, right *node
+}
+
+func setDepth(n *node, depth uint, lengths []uint) uint {
+	if n.left == nil {
+		lengths[n.symbol] = depth
+		return depth
+	}
+	l := setDepth(n.left, depth+1, lengths)
+	r := setDepth(n.right, depth+1, lengths)
+	if l > r {
+		return l
+	}
+	return r
+}
+
+type nodeHeap []*node
+
+func (h nodeHeap) Len() int           { return len(h) }
+func (h nodeHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h nodeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*node)) }
+
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// writePrefixCode writes the code lengths with a code length code of literal lengths only.
+func writePrefixCode(w *bitWriter, c prefixCode) {
+	counts := make([]int, maxCodeLength+1)
+	for _, l := range c.lengths {
+		counts[l]++
+	}
+	lengthCode := newPrefixCode(counts, maxCodeLengthCodeLength)
+
+	w.bits(0, 1) //normal code
+	w.bits(uint32(len(codeLengthCodeOrder)-4), 4)
+	for _, symbol := range codeLengthCodeOrder {
+		var l uint
+		if symbol < len(lengthCode.lengths) {
+			l = lengthCode.lengths[symbol]
+		}
+		w.bits(uint32(l), 3)
+	}
+	w.bits(0, 1) //lengths for the whole alphabet follow
+	for _, l := range c.lengths {
+		w.code(lengthCode, int(l))
+	}
+}
+
+// token is a literal argb pixel, or a copy of the previous pixel when length is set.
+type token struct {
+	argb   uint32
+	length int
+}
+
+// encodeImage writes the pixels with one group of prefix codes and no color cache,
+// runs of the same pixel are backward references at distance 1.
+func encodeImage(w *bitWriter, argb []uint32, main bool) {
+	var tokens []token
+	for i := 0; i < len(argb); {
+		run := 0
+		for i > 0 && i+run < len(argb) && run < maxRun && argb[i+run] == argb[i-1] {
+			run++
+		}
+		if run >= minRun {
+			tokens = append(tokens, token{length: run})
+			i += run
+			continue
+		}
+		tokens = append(tokens, token{argb: argb[i]})
+		i++
+	}
+
+	green := make([]int, numLiterals+numLengthCodes)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	distance := make([]int, numDistanceCode)
+	for _, t := range tokens {
+		if t.length > 0 {
+			prefix, _, _ := prefixEncode(t.length)
+			green[numLiterals+prefix]++
+			distance[distancePrefix]++
+			continue
+		}
+		green[t.argb>>8&0xff]++
+		red[t.argb>>16&0xff]++
+		blue[t.argb&0xff]++
+		alpha[t.argb>>24]++
+	}
+
+	w.bits(0, 1) //no color cache
+	if main {
+		w.bits(0, 1) //a single group of prefix codes for the whole image
+	}
+	codes := []prefixCode{
+		newPrefixCode(green, maxCodeLength),
+		newPrefixCode(red, maxCodeLength),
+		newPrefixCode(blue, maxCodeLength),
+		newPrefixCode(alpha, maxCodeLength),
+		newPrefixCode(distance, maxCodeLength),
+	}
+	for _, c := range codes {
+		writePrefixCode(w, c)
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			prefix, extraBits, extra := prefixEncode(t.length)
+			w.code(codes[0], numLiterals+prefix)
+			w.bits(extra, extraBits)
+			w.code(codes[4], distancePrefix)
+			continue
+		}
+		w.code(codes[0], int(t.argb>>8&0xff))
+		w.code(codes[1], int(t.argb>>16&0xff))
+		w.code(codes[2], int(t.argb&0xff))
+		w.code(codes[3], int(t.argb>>24))
+	}
+}
+
+// distancePrefix encodes the distance code 2, which maps to the previous pixel, without extra bits.
+const distancePrefix = 1
+
+// prefixEncode splits a backward reference length or distance code in a prefix symbol and extra bits.
+func prefixEncode(v int) (int, uint, uint32) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	x := v - 1
+	high := uint(bits.Len(uint(x)) - 1)
+	second := x >> (high - 1) & 1
+	return int(2*high) + second, high - 1, uint32(x & (1<<(high-1) - 1))
+}
@@ -0,0 +1,215 @@
+// Package webp encodes images as lossless webp (VP8L).
+//
+// Only the parts of the format needed for small uploads are used: the subtract green and predictor
+// transforms, prefix codes and run length backward references. See https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	maxDimension = 1 << 14
+
+	predictorTransform     = 0
+	subtractGreenTransform = 2
+
+	//predictor tiles of 16x16 pixels
+	predictorBits = 4
+
+	//runs shorter than this are cheaper as literals
+	minRun = 3
+	maxRun = 4096
+)
+
+var ErrTooLarge = errors.New("webp: image dimensions exceed 16384 pixels")
+
+// candidate predictor modes, tried for every tile. Modes reading the top right pixel are left out
+// as they have edge rules of their own.
+var predictorModes = []int{1, 2, 7, 12}
+
+// Encode writes m as a lossless webp image.
+func Encode(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return ErrTooLarge
+	}
+
+	argb, alpha := pixels(m)
+	subtractGreen(argb)
+	modes, residuals := predict(argb, width, height)
+
+	bw := &bitWriter{}
+	bw.bits(0x2f, 8)
+	bw.bits(uint32(width-1), 14)
+	bw.bits(uint32(height-1), 14)
+	if alpha {
+		bw.bits(1, 1)
+	} else {
+		bw.bits(0, 1)
+	}
+	bw.bits(0, 3) //version
+
+	bw.bits(1, 1)
+	bw.bits(subtractGreenTransform, 2)
+	bw.bits(1, 1)
+	bw.bits(predictorTransform, 2)
+	bw.bits(predictorBits-2, 3)
+	encodeImage(bw, modes, false)
+	bw.bits(0, 1) //no more transforms
+
+	encodeImage(bw, residuals, true)
+	data := bw.flush()
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	size := 4 + 8 + len(data) + len(data)&1
+	binary.Write(&out, binary.LittleEndian, uint32(size))
+	out.WriteString("WEBPVP8L")
+	binary.Write(&out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+	if len(data)&1 == 1 {
+		out.WriteByte(0)
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// pixels of m as non premultiplied argb, and whether any of them is not opaque.
+func pixels(m image.Image) ([]uint32, bool) {
+	b := m.Bounds()
+	argb := make([]uint32, 0, b.Dx()*b.Dy())
+	alpha := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var c color.NRGBA
+			if n, ok := m.(*image.NRGBA); ok {
+				c = n.NRGBAAt(x, y)
+			} else {
+				c = color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			}
+			if c.A != 0xff {
+				alpha = true
+			}
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+	return argb, alpha
+}
+
+// subtractGreen removes the green value from red and blue, which are usually correlated.
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict picks the predictor mode of every tile and returns the tile modes, as the green
+// value of a sub image, and the residuals of every pixel against its prediction.
+func predict(argb []uint32, width, height int) ([]uint32, []uint32) {
+	tilesX := (width + 1<<predictorBits - 1) >> predictorBits
+	tilesY := (height + 1<<predictorBits - 1) >> predictorBits
+	modes := make([]int, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := predictorModes[0], -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := ty << predictorBits; y < height && y < (ty+1)<<predictorBits; y++ {
+					for x := tx << predictorBits; x < width && x < (tx+1)<<predictorBits; x++ {
+						cost += residualCost(sub(argb[y*width+x], prediction(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = best
+		}
+	}
+
+	residuals := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := modes[(y>>predictorBits)*tilesX+x>>predictorBits]
+			residuals[y*width+x] = sub(argb[y*width+x], prediction(argb, width, x, y, mode))
+		}
+	}
+
+	tiles := make([]uint32, len(modes))
+	for i, mode := range modes {
+		tiles[i] = uint32(mode) << 8
+	}
+	return tiles, residuals
+}
+
+// prediction of the pixel at x, y from its already decoded neighbours.
+func prediction(argb []uint32, width, x, y, mode int) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[x-1]
+	case x == 0:
+		return argb[(y-1)*width]
+	}
+	l, t, tl := argb[y*width+x-1], argb[(y-1)*width+x], argb[(y-1)*width+x-1]
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 7:
+		return average2(l, t)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	}
+	panic("webp: unsupported predictor mode")
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 0xff {
+			v = 0xff
+		}
+		p |= uint32(v) << shift
+	}
+	return p
+}
+
+// sub subtracts every channel modulo 256.
+func sub(a, b uint32) uint32 {
+	alphaGreen := (0x00ff00ff + a&0xff00ff00 - b&0xff00ff00) & 0xff00ff00
+	redBlue := (0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff) & 0x00ff00ff
+	return alphaGreen | redBlue
+}
+
+// residualCost estimates the bits of a residual, small values in either direction are cheap.
+func residualCost(r uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(int8(r >> shift))
+		if v < 0 {
+			v = -v
+		}
+		cost += v
+	}
+	return cost
+}
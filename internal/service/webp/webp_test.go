@@ -0,0 +1,96 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name          string
+		width, height int
+		at            func(x, y int) color.NRGBA
+	}{
+		{"single pixel", 1, 1, func(x, y int) color.NRGBA { return color.NRGBA{10, 20, 30, 255} }},
+		{"flat", 5000, 3, func(x, y int) color.NRGBA { return color.NRGBA{200, 100, 50, 255} }},
+		{"gradient", 97, 61, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 2), uint8(y * 4), uint8(x + y), 255}
+		}},
+		{"alpha", 40, 33, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 6), 80, uint8(y * 7), uint8(x * y)}
+		}},
+		{"noise", 64, 64, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256))}
+		}},
+		{"stripes", 130, 20, func(x, y int) color.NRGBA {
+			if (x/7+y/3)%2 == 0 {
+				return color.NRGBA{255, 255, 255, 255}
+			}
+			return color.NRGBA{0, 0, 0, 0}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//bounds not starting at the origin, like sub images
+			src := image.NewNRGBA(image.Rect(3, 5, 3+tt.width, 5+tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					src.SetNRGBA(3+x, 5+y, tt.at(x, y))
+				}
+			}
+			var buf bytes.Buffer
+			if err := Encode(&buf, src); err != nil {
+				t.Fatal(err)
+			}
+			m, err := xwebp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got, ok := m.(*image.NRGBA)
+			if !ok {
+				t.Fatalf("decoded a %T", m)
+			}
+			if got.Bounds().Dx() != tt.width || got.Bounds().Dy() != tt.height {
+				t.Fatalf("bounds = %v", got.Bounds())
+			}
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					want := src.NRGBAAt(3+x, 5+y)
+					if c := got.NRGBAAt(got.Bounds().Min.X+x, got.Bounds().Min.Y+y); c != want {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, c, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeTooLarge(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, maxDimension+1, 1))); err != ErrTooLarge {
+		t.Fatalf("err = %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestPrefixEncode(t *testing.T) {
+	//every value must come back from the prefix symbol and its extra bits
+	for v := 1; v <= maxRun; v++ {
+		prefix, extraBits, extra := prefixEncode(v)
+		got := prefix + 1
+		if prefix >= 4 {
+			n := uint(prefix-2) >> 1
+			if n != extraBits {
+				t.Fatalf("value %d: %d extra bits, want %d", v, extraBits, n)
+			}
+			got = (2+prefix&1)<<n + int(extra) + 1
+		}
+		if got != v || prefix >= numLengthCodes {
+			t.Fatalf("value %d encoded as prefix %d extra %d decodes to %d", v, prefix, extra, got)
+		}
+	}
+}
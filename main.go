@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/paritoshyadav/socialnetwork/internal/handler"
 	"github.com/paritoshyadav/socialnetwork/internal/service"
 	"github.com/paritoshyadav/socialnetwork/internal/service/codec"
+	"github.com/paritoshyadav/socialnetwork/internal/service/mailer"
+	"github.com/paritoshyadav/socialnetwork/internal/service/oidc"
+	"github.com/paritoshyadav/socialnetwork/internal/service/storage"
+	"golang.org/x/crypto/hkdf"
 )
 
 func main() {
@@ -19,7 +26,27 @@ func main() {
 		port        = env("PORT", ":8000")
 		databaseURL = env("DATABASE_URL", "postgresql://root@127.0.0.1:26257/socially?sslmode=disable") //add database name in link
 		secrettoken = env("BRANCA_TOKEN", "supersecretkeyyoushouldnotcommit")
+		keys        = env("BRANCA_KEYS", "") //newest first, "id:secret,id:secret"
+		keysFile    = env("BRANCA_KEYS_FILE", "")
+		tokenFormat = env("TOKEN_FORMAT", "branca") //branca, paseto or jwt
 		origin      = env("ORIGIN", "http://localhost"+port)
+		resetURL    = env("PASSWORD_RESET_URL", "") //ORIGIN/password_reset when empty
+		smtpHost    = env("SMTP_HOST", "")
+		smtpPort    = env("SMTP_PORT", "587")
+		smtpUser    = env("SMTP_USERNAME", "")
+		smtpPass    = env("SMTP_PASSWORD", "")
+		mailFrom    = env("MAIL_FROM", "no-reply@socially.local")
+		oidcFile    = env("OIDC_PROVIDERS_FILE", "")
+		linkSecret  = env("LINK_SECRET", "") //derived from the current token key when empty
+		verifyEmail = env("REQUIRE_VERIFIED_EMAIL", "false")
+		s3Endpoint  = env("S3_ENDPOINT", "") //keeps uploads on the local disk when empty
+		s3Region    = env("S3_REGION", "us-east-1")
+		s3Bucket    = env("S3_BUCKET", "")
+		s3AccessKey = env("S3_ACCESS_KEY", "")
+		s3SecretKey = env("S3_SECRET_KEY", "")
+		s3PublicURL = env("S3_PUBLIC_URL", "")
+		s3URLExpiry = env("S3_URL_EXPIRY", storage.MaxURLExpiry.String())
+		editWindow  = env("POST_EDIT_WINDOW", service.DefaultPostEditWindow.String())
 	)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -37,9 +64,105 @@ func main() {
 	}
 	defer db.Close()
 
-	c := codec.New(secrettoken, service.TokenLifetime)
+	ring, err := keyRing(keys, keysFile, secrettoken)
+	if err != nil {
+		log.Fatal("could not load token keys ", err)
+		return
+	}
+
+	var c codec.CodecLayer
+	switch tokenFormat {
+	case "branca":
+		c = codec.New(ring, service.TokenLifetime)
+	case "paseto":
+		c = codec.NewPaseto(ring, service.TokenLifetime)
+	case "jwt":
+		c = codec.NewJWT(ring, service.TokenLifetime)
+	default:
+		log.Fatalf("unknown token format %q", tokenFormat)
+		return
+	}
+
+	var m mailer.MailerLayer = mailer.NewLog(os.Stdout) //print mails when no smtp server is configured
+	if smtpHost != "" {
+		m = mailer.NewSMTP(smtpHost, smtpPort, smtpUser, smtpPass, mailFrom)
+	}
+
+	s := service.New(db, c, m, origin)
+	if resetURL != "" {
+		s.PasswordResetURL = resetURL
+	}
+	s.LinkSecret, err = linkKey(linkSecret, ring)
+	if err != nil {
+		log.Fatal("could not derive link secret ", err)
+		return
+	}
+	s.RequireVerifiedEmail, err = strconv.ParseBool(verifyEmail)
+	if err != nil {
+		log.Fatal("invalid REQUIRE_VERIFIED_EMAIL ", err)
+		return
+	}
+	backfilled, err := s.BackfillVerifiedEmails(ctx)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	if backfilled > 0 {
+		log.Printf("marked %d users created before email verification as verified", backfilled)
+	}
 
-	s := service.New(db, c, origin)
+	s.PostEditWindow, err = time.ParseDuration(editWindow)
+	if err != nil {
+		log.Fatal("invalid POST_EDIT_WINDOW ", err)
+		return
+	}
+
+	if s3Endpoint != "" {
+		urlExpiry, err := time.ParseDuration(s3URLExpiry)
+		if err != nil {
+			log.Fatal("invalid S3_URL_EXPIRY ", err)
+			return
+		}
+		s.Storage, err = storage.NewS3(storage.S3Config{
+			Endpoint:  s3Endpoint,
+			Region:    s3Region,
+			Bucket:    s3Bucket,
+			AccessKey: s3AccessKey,
+			SecretKey: s3SecretKey,
+			PublicURL: s3PublicURL,
+			URLExpiry: urlExpiry,
+		})
+		if err != nil {
+			log.Fatal("could not setup s3 storage ", err)
+			return
+		}
+	}
+
+	//after the storage is picked, avatars uploaded before the sizes existed are resized from their original
+	resized, err := s.BackfillAvatarSizes(context.Background()) //can outlast the startup timeout
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	if resized > 0 {
+		log.Printf("generated the sizes of %d avatars uploaded before them", resized)
+	}
+
+	if oidcFile != "" {
+		configs, err := oidc.LoadConfigs(oidcFile)
+		if err != nil {
+			log.Fatal("could not load oidc providers ", err)
+			return
+		}
+		for _, cfg := range configs {
+			p, err := oidc.Discover(ctx, cfg, origin+"/oauth/"+cfg.Name+"/callback")
+			if err != nil {
+				log.Fatal("could not setup oidc provider ", err)
+				return
+			}
+			s.OIDCProviders[cfg.Name] = p
+		}
+	}
 
 	fmt.Println(s)
 	defer func() {
@@ -56,6 +179,32 @@ func main() {
 
 }
 
+// keyRing loads the token keys from a file or env, falling back to the single BRANCA_TOKEN secret.
+func keyRing(keys, keysFile, secret string) (codec.KeyRing, error) {
+	if keysFile != "" {
+		return codec.LoadKeyRing(keysFile)
+	}
+	if keys != "" {
+		return codec.ParseKeyRing(keys)
+	}
+	ring := codec.KeyRing{{ID: "default", Secret: secret}}
+	return ring, ring.Validate()
+}
+
+// linkKey is LINK_SECRET or a key derived from the current token key, so the token key itself never
+// signs anything else. Without LINK_SECRET rotating the token keys invalidates pending links.
+func linkKey(secret string, ring codec.KeyRing) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	key := make([]byte, 32)
+	r := hkdf.New(sha256.New, []byte(ring.Current().Secret), nil, []byte("socially email verification links"))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 func env(Key, fallbackValue string) string {
 	s := os.Getenv(Key)
 	if s == "" {
@@ -1,4 +1,5 @@
-DROP DATABASE IF EXISTS socially CASCADE;
+-- safe to run again on an existing database, the ALTER statements bring older tables up to date.
+-- DROP DATABASE socially CASCADE first to start over.
 
 CREATE DATABASE IF NOT EXISTS socially;
 
@@ -13,12 +14,135 @@ CREATE TABLE IF NOT EXISTS users (
     followings_count INT NOT NULL DEFAULT 0 CHECK (followings_count >= 0)
 );
 
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS banner VARCHAR,
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS bio VARCHAR(160),
+    ADD COLUMN IF NOT EXISTS website VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS location VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS password_hash VARCHAR,
+    ADD COLUMN IF NOT EXISTS totp_secret VARCHAR,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS totp_last_step INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mfa_failures INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mfa_locked_until TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP, -- users without it or verification_sent_at are marked verified at startup
+    ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS users_username_trgm_index ON users USING GIN (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_display_name_trgm_index ON users USING GIN (display_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_bio_trgm_index ON users USING GIN (bio gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_followers_count_index ON users (followers_count DESC);
+
+CREATE TABLE IF NOT EXISTS login_codes (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    code_hash VARCHAR NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    refresh_token_hash VARCHAR NOT NULL UNIQUE,
+    previous_token_hash VARCHAR,
+    user_agent VARCHAR NOT NULL DEFAULT '',
+    ip VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_index ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_previous_token_hash_index ON sessions (previous_token_hash);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    label VARCHAR NOT NULL,
+    prefix VARCHAR NOT NULL,
+    key_hash VARCHAR NOT NULL UNIQUE,
+    read_only BOOLEAN NOT NULL DEFAULT FALSE,
+    route_groups VARCHAR[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_index ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    code_hash VARCHAR NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS recovery_codes_user_code_index ON recovery_codes (user_id, code_hash);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    user_id INT NOT NULL REFERENCES users,
+    provider VARCHAR NOT NULL,
+    subject VARCHAR NOT NULL,
+    email VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider,subject)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_user_provider_index ON user_identities (user_id, provider);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    id SERIAL PRIMARY KEY NOT NULL,
+    state_hash VARCHAR NOT NULL UNIQUE,
+    provider VARCHAR NOT NULL,
+    nonce VARCHAR NOT NULL,
+    user_id INT REFERENCES users,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS username_history (
+    username VARCHAR(255) PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    changed_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_user_id_index ON username_history (user_id);
+
 CREATE TABLE IF NOT EXISTS follows (
     follower_id INT NOT NULL REFERENCES users,
     following_id INT NOT NULL REFERENCES users,
     PRIMARY KEY (follower_id,following_id)
 );
 
+ALTER TABLE follows ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS follows_follower_created_at_index ON follows (follower_id, created_at DESC);
+
 CREATE TABLE IF NOT EXISTS posts (
     id SERIAL PRIMARY KEY NOT NULL,
     user_id INT NOT NULL REFERENCES users,
@@ -31,12 +155,26 @@ CREATE TABLE IF NOT EXISTS posts (
     nsfw BOOLEAN NOT NULL DEFAULT FALSE
 );
 
+CREATE INDEX IF NOT EXISTS posts_user_created_at_index ON posts (user_id, created_at DESC);
+
 CREATE TABLE IF NOT EXISTS likes (
     user_id INT NOT NULL REFERENCES users,
     post_id INT NOT NULL REFERENCES posts,
     PRIMARY KEY (user_id,post_id)
 );
 
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id SERIAL PRIMARY KEY NOT NULL,
+    post_id INT NOT NULL REFERENCES posts,
+    content VARCHAR NOT NULL,
+    spoiler VARCHAR,
+    nsfw BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL, -- when this version was written
+    replaced_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS post_revisions_post_id_index ON post_revisions (post_id, id DESC);
+
 CREATE TABLE IF NOT EXISTS post_subscriptions (
     user_id INT NOT NULL REFERENCES users,
     post_id INT NOT NULL REFERENCES posts,
@@ -61,6 +199,41 @@ CREATE TABLE IF NOT EXISTS comment_likes (
 CREATE INDEX IF NOT EXISTS posts_created_at_index ON posts (created_at DESC);
 CREATE INDEX IF NOT EXISTS comments_created_at_index ON comments (created_at DESC);
 
+CREATE TABLE IF NOT EXISTS follow_requests (
+    requester_id INT NOT NULL REFERENCES users,
+    target_id INT NOT NULL REFERENCES users,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (requester_id, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS follow_requests_target_id_index ON follow_requests (target_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id INT NOT NULL REFERENCES users,
+    blocked_id INT NOT NULL REFERENCES users,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS blocks_blocked_id_index ON blocks (blocked_id);
+
+CREATE TABLE IF NOT EXISTS mutes (
+    muter_id INT NOT NULL REFERENCES users,
+    muted_id INT NOT NULL REFERENCES users,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP,
+    PRIMARY KEY (muter_id, muted_id)
+);
+
+CREATE TABLE IF NOT EXISTS muted_words (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    phrase VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP,
+    UNIQUE (user_id, phrase)
+);
+
 CREATE TABLE IF NOT EXISTS timelines (
     id SERIAL PRIMARY KEY NOT NULL,
     user_id INT NOT NULL REFERENCES users,
@@ -69,6 +242,36 @@ CREATE TABLE IF NOT EXISTS timelines (
 
 CREATE UNIQUE INDEX IF NOT EXISTS timelines_user_post_index ON timelines (user_id, post_id);
 
+CREATE TABLE IF NOT EXISTS lists (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL REFERENCES users,
+    name VARCHAR(50) NOT NULL,
+    description VARCHAR(160),
+    is_private BOOLEAN NOT NULL DEFAULT FALSE,
+    members_count INT NOT NULL DEFAULT 0 CHECK (members_count >= 0),
+    subscribers_count INT NOT NULL DEFAULT 0 CHECK (subscribers_count >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id INT NOT NULL REFERENCES lists,
+    user_id INT NOT NULL REFERENCES users,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_members_user_id_index ON list_members (user_id);
+
+CREATE TABLE IF NOT EXISTS list_subscriptions (
+    list_id INT NOT NULL REFERENCES lists,
+    user_id INT NOT NULL REFERENCES users,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_subscriptions_user_id_index ON list_subscriptions (user_id);
+
 Create TABLE If NOT EXISTS notifications (
     id SERIAL PRIMARY KEY NOT NULL,
     user_id INT NOT NULL REFERENCES users,
@@ -79,6 +282,19 @@ Create TABLE If NOT EXISTS notifications (
     issued_at TIMESTAMP NOT NULL DEFAULT now()
 );
 
+-- actors held usernames, which change, actor_ids replaces it keeping the order, newest first.
+-- actors is added back first so these statements also run once it is gone.
+ALTER TABLE notifications
+    ADD COLUMN IF NOT EXISTS actor_ids INT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS list_id INT REFERENCES lists,
+    ADD COLUMN IF NOT EXISTS actors VARCHAR[];
+UPDATE notifications SET actor_ids = ARRAY(
+    SELECT users.id FROM unnest(notifications.actors) WITH ORDINALITY AS actor (username, n)
+    INNER JOIN users ON users.username = actor.username
+    ORDER BY actor.n
+) WHERE actors IS NOT NULL AND actor_ids = '{}';
+ALTER TABLE notifications DROP COLUMN IF EXISTS actors;
+
 Create INDEX If NOT EXISTS notifications_issued_at_index ON notifications (issued_at DESC);
 Create UNIQUE INDEX If NOT EXISTS notifications_index ON notifications (user_id, type, read,post_id);
 
@@ -86,13 +302,13 @@ Create UNIQUE INDEX If NOT EXISTS notifications_index ON notifications (user_id,
 
 
 
-INSERT INTO users (id,email,username,followers_count,followings_count) VALUES (1,'test@test.com','testuser',1,0),(2,'anothertest@test.com','anothertestuser',0,1),(3,'john@test.com','john',0,0),(4,'josh@test.com','josh',0,0);
-INSERT INTO follows (follower_id,following_id) VALUES (2,1);
-INSERT INTO posts (id,user_id,content,comments_count) VALUES (21,1,'test post by testUser',1),(22,1,'another test post by testUser',1);
-INSERT INTO post_subscriptions (user_id,post_id) VALUES (1,21),(1,22);
-INSERT INTO timelines (user_id,post_id) VALUES (1,21),(1,22),(2,21),(2,22);
+INSERT INTO users (id,email,username,followers_count,followings_count) VALUES (1,'test@test.com','testuser',1,0),(2,'anothertest@test.com','anothertestuser',0,1),(3,'john@test.com','john',0,0),(4,'josh@test.com','josh',0,0) ON CONFLICT DO NOTHING;
+INSERT INTO follows (follower_id,following_id) VALUES (2,1) ON CONFLICT DO NOTHING;
+INSERT INTO posts (id,user_id,content,comments_count) VALUES (21,1,'test post by testUser',1),(22,1,'another test post by testUser',1) ON CONFLICT DO NOTHING;
+INSERT INTO post_subscriptions (user_id,post_id) VALUES (1,21),(1,22) ON CONFLICT DO NOTHING;
+INSERT INTO timelines (user_id,post_id) VALUES (1,21),(1,22),(2,21),(2,22) ON CONFLICT DO NOTHING;
 -- INSERT INTO likes (user_id,post_id) VALUES (1,21),(1,22),(2,21),(2,22);
-INSERT INTO comments (id,user_id,post_id,content) VALUES (31,1,21,'test comment by testUser'),(32,1,22,'another test comment by testUser');
+INSERT INTO comments (id,user_id,post_id,content) VALUES (31,1,21,'test comment by testUser'),(32,1,22,'another test comment by testUser') ON CONFLICT DO NOTHING;
 -- INSERT INTO comment_likes (user_id,comment_id) VALUES (1,31),(1,32),(2,31),(2,32);
 
 